@@ -0,0 +1,528 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"huffman_coding/huffman"
+)
+
+func runZip(args []string) error {
+	set := newFlagSet("zip", "[-f] [-m method] [-preseed] [-dict file] archive.zip files...")
+	force := set.Bool("f", false, "overwrite an existing archive")
+	methodName := set.String("m", "huffman", "coding method: "+methodNames())
+	preseed := set.Bool("preseed", false, "start the model with all bytes seen once, better for short inputs")
+	dictName := set.String("dict", "", "prime the model with the dictionary `file` made by train")
+	set.Parse(args)
+	if set.NArg() < 2 {
+		set.Usage()
+		os.Exit(exitUsage)
+	}
+
+	dict, err := loadDictionary(*dictName)
+	if err != nil {
+		return err
+	}
+	opts := huffman.Options{Method: parseMethod(set, *methodName), Preseed: *preseed, Dictionary: dict}
+
+	name := set.Arg(0)
+	out, err := createOutput(name, 0o666, *force)
+	if err != nil {
+		return err
+	}
+	self, err := out.Stat()
+	if err != nil {
+		out.Close()
+		return err
+	}
+	zw := zip.NewWriter(out)
+	zw.RegisterCompressor(huffman.ZipMethod, huffman.ZipCompressor(opts))
+
+	err = walkFiles(set.Args()[1:], self, func(path string, fi fs.FileInfo) error {
+		return addZipEntry(zw, path, fi)
+	})
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil && err != errSilent {
+		os.Remove(name)
+	}
+	return err
+}
+
+// walkFiles calls fn for the named files and everything in the named directories,
+// except for the archive being written, whose info is self.
+// Errors are reported as they happen without stopping the walk,
+// returns errSilent if there were any.
+func walkFiles(roots []string, self fs.FileInfo, fn func(path string, fi fs.FileInfo) error) error {
+	failed := false
+	for _, root := range roots {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			var fi fs.FileInfo
+			if err == nil {
+				fi, err = d.Info()
+			}
+			if err == nil && !os.SameFile(fi, self) {
+				err = fn(path, fi)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "huff: %s: %v\n", path, err)
+				failed = true
+			}
+			return nil
+		})
+	}
+	if failed {
+		return errSilent
+	}
+	return nil
+}
+
+// addZipEntry adds the file at path to zw, compressing regular files with huffman.ZipMethod.
+func addZipEntry(zw *zip.Writer, path string, fi fs.FileInfo) error {
+	entryName, err := archiveName(path)
+	if err != nil {
+		return err
+	}
+	fh, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return err
+	}
+	fh.Name = entryName
+
+	switch {
+	case fi.IsDir():
+		if entryName == "." {
+			return nil
+		}
+		fh.Name += "/"
+		_, err = zw.CreateHeader(fh)
+		return err
+	case !fi.Mode().IsRegular():
+		return errors.New("not a regular file -- ignored")
+	}
+
+	fh.Method = huffman.ZipMethod
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	w, err := zw.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, in)
+	return err
+}
+
+// archiveName returns the name of the file at path inside an archive:
+// slash separated and relative, without leading slashes.
+// Paths leading out of the current directory are refused.
+func archiveName(path string) (string, error) {
+	name := strings.TrimLeft(filepath.ToSlash(filepath.Clean(path)), "/")
+	if name == "" {
+		name = "."
+	}
+	if !filepath.IsLocal(filepath.FromSlash(name)) && name != "." {
+		return "", errors.New("path outside the current directory -- ignored")
+	}
+	return name, nil
+}
+
+func runUnzip(args []string) error {
+	set := newFlagSet("unzip", "[-l] [-f] [-d dir] [-dict file] [-max-size n] [-max-ratio r] archive.zip [names...]")
+	list := set.Bool("l", false, "list the entries instead of extracting them")
+	force := set.Bool("f", false, "overwrite existing files")
+	dir := set.String("d", ".", "extract into `dir`")
+	var lf limitFlags
+	lf.register(set)
+	dictName := set.String("dict", "", "dictionary `file` the entries were compressed with")
+	set.Parse(args)
+	if set.NArg() < 1 {
+		set.Usage()
+		os.Exit(exitUsage)
+	}
+
+	dict, err := loadDictionary(*dictName)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.OpenReader(set.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	zr.RegisterDecompressor(huffman.ZipMethod, huffman.ZipDecompressor(lf.options(huffman.Options{Dictionary: dict})))
+
+	members := memberFilter(set.Args()[1:])
+	var files []*zip.File
+	for _, f := range zr.File {
+		if members(f.Name) {
+			files = append(files, f)
+		}
+	}
+
+	if *list {
+		fmt.Printf("%12s %12s %7s  %-16s  %s\n", "compressed", "size", "saved", "modified", "name")
+		for _, f := range files {
+			fmt.Printf("%12d %12d %7s  %-16s  %s\n", f.CompressedSize64, f.UncompressedSize64,
+				ratio(int64(f.CompressedSize64), int64(f.UncompressedSize64)),
+				f.Modified.Local().Format("2006-01-02 15:04"), f.Name)
+		}
+		return nil
+	}
+
+	failed := false
+	for _, f := range files {
+		if err := extractZipEntry(f, *dir, *force); err != nil {
+			fmt.Fprintf(os.Stderr, "huff: %s: %v\n", f.Name, limitHint(err))
+			failed = true
+		}
+	}
+	if failed {
+		return errSilent
+	}
+	return nil
+}
+
+// extractZipEntry writes the file of f into dir.
+// Nothing is ever written outside dir, neither through .. in names nor through symbolic links.
+func extractZipEntry(f *zip.File, dir string, force bool) error {
+	path, err := extractPath(dir, f.Name)
+	if err != nil {
+		return err
+	}
+	if err := checkParents(dir, path); err != nil {
+		return err
+	}
+	mode := f.Mode()
+	if mode.IsDir() {
+		return os.MkdirAll(path, 0o777)
+	}
+	if !mode.IsRegular() {
+		return errors.New("not a regular file -- ignored")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+		return err
+	}
+	if err := removeExisting(path, force); err != nil {
+		return err
+	}
+
+	in, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFile(path, in, mode.Perm(), f.Modified)
+}
+
+// extractPath returns the path in dir of the archive member name.
+// Names which are absolute or lead out of dir are refused.
+func extractPath(dir, name string) (string, error) {
+	local := filepath.FromSlash(strings.TrimSuffix(name, "/"))
+	if !filepath.IsLocal(local) {
+		return "", errors.New("unsafe path -- ignored")
+	}
+	return filepath.Join(dir, local), nil
+}
+
+// memberFilter returns a function telling if an archive member has been asked for by name.
+// No names at all means every member.
+// Asking for a directory asks for everything in it.
+func memberFilter(names []string) func(name string) bool {
+	return func(name string) bool {
+		if len(names) == 0 {
+			return true
+		}
+		name = strings.TrimSuffix(name, "/")
+		for _, n := range names {
+			n = strings.TrimSuffix(filepath.ToSlash(n), "/")
+			if name == n || strings.HasPrefix(name, n+"/") {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// writeFile writes the content of r into the new named file with the given mode and modification time.
+// A partial file is removed on errors.
+func writeFile(name string, r io.Reader, mode fs.FileMode, modified time.Time) error {
+	out, err := createOutput(name, mode, false)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, r)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(name, mode)
+	}
+	if err == nil && !modified.IsZero() {
+		err = os.Chtimes(name, modified, modified)
+	}
+	if err != nil {
+		os.Remove(name)
+	}
+	return err
+}
+
+// defaultArchiveSuffix is the suffix of compressed tar archives.
+const defaultArchiveSuffix = ".thf"
+
+func runArchive(args []string) error {
+	set := newFlagSet("archive", "-o archive"+defaultArchiveSuffix+" [-f] [-m method] [-preseed] [-dict file] files...")
+	outName := set.String("o", "", "write the archive to `file`, - for standard output")
+	force := set.Bool("f", false, "overwrite an existing archive")
+	methodName := set.String("m", "huffman", "coding method: "+methodNames())
+	preseed := set.Bool("preseed", false, "start the model with all bytes seen once, better for short inputs")
+	dictName := set.String("dict", "", "prime the model with the dictionary `file` made by train")
+	set.Parse(args)
+	if *outName == "" || set.NArg() == 0 {
+		set.Usage()
+		os.Exit(exitUsage)
+	}
+
+	dict, err := loadDictionary(*dictName)
+	if err != nil {
+		return err
+	}
+	opts := huffman.Options{Method: parseMethod(set, *methodName), Preseed: *preseed, Dictionary: dict}
+
+	out := os.Stdout
+	var self fs.FileInfo
+	if *outName != "-" {
+		if out, err = createOutput(*outName, 0o666, *force); err != nil {
+			return err
+		}
+		if self, err = out.Stat(); err != nil {
+			out.Close()
+			return err
+		}
+	}
+
+	// the tar stream goes through the Huffman coder as a whole,
+	// so the model learns across all the files
+	hw := huffman.NewWriterOptions(out, opts)
+	tw := tar.NewWriter(hw)
+	err = walkFiles(set.Args(), self, func(path string, fi fs.FileInfo) error {
+		return addTarEntry(tw, path, fi)
+	})
+	if closeErr := tw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := hw.Close(); err == nil {
+		err = closeErr
+	}
+	if *outName != "-" {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil && err != errSilent {
+			os.Remove(*outName)
+		}
+	}
+	return err
+}
+
+// addTarEntry adds the file at path to tw, keeping its mode, modification time
+// and the target of symbolic links.
+func addTarEntry(tw *tar.Writer, path string, fi fs.FileInfo) error {
+	entryName, err := archiveName(path)
+	if err != nil {
+		return err
+	}
+	var link string
+	mode := fi.Mode()
+	switch {
+	case mode.IsDir():
+		if entryName == "." {
+			return nil
+		}
+		entryName += "/"
+	case mode&fs.ModeSymlink != 0:
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	case !mode.IsRegular():
+		return errors.New("not a regular file, directory or symbolic link -- ignored")
+	}
+	th, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return err
+	}
+	th.Name = entryName
+	if err := tw.WriteHeader(th); err != nil {
+		return err
+	}
+	if !mode.IsRegular() {
+		return nil
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	// the header has promised th.Size bytes, files changing meanwhile make the copy fail
+	_, err = io.CopyN(tw, in, th.Size)
+	return err
+}
+
+func runExtract(args []string) error {
+	set := newFlagSet("extract", "[-l] [-f] [-d dir] [-dict file] [-max-size n] [-max-ratio r] archive"+defaultArchiveSuffix+" [names...]")
+	list := set.Bool("l", false, "list the members instead of extracting them")
+	force := set.Bool("f", false, "overwrite existing files")
+	dir := set.String("d", ".", "extract into `dir`")
+	var lf limitFlags
+	lf.register(set)
+	dictName := set.String("dict", "", "dictionary `file` the archive was compressed with")
+	set.Parse(args)
+	if set.NArg() < 1 {
+		set.Usage()
+		os.Exit(exitUsage)
+	}
+
+	dict, err := loadDictionary(*dictName)
+	if err != nil {
+		return err
+	}
+	members := memberFilter(set.Args()[1:])
+	return withInput(set.Arg(0), func(in io.Reader) error {
+		// the limits apply to the whole tar stream
+		tr := tar.NewReader(huffman.NewReaderOptions(in, lf.options(huffman.Options{Dictionary: dict})))
+		// directories get their mode and modification time once everything in them has been written
+		var dirs []*tar.Header
+		failed := false
+		for {
+			th, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return limitHint(err)
+			}
+			if !members(th.Name) {
+				continue
+			}
+			if *list {
+				printTarEntry(th)
+				continue
+			}
+			if th.Typeflag == tar.TypeDir {
+				dirs = append(dirs, th)
+			}
+			if err := extractTarEntry(tr, th, *dir, *force); err != nil {
+				fmt.Fprintf(os.Stderr, "huff: %s: %v\n", th.Name, limitHint(err))
+				failed = true
+			}
+		}
+
+		for i := len(dirs) - 1; i >= 0; i-- {
+			th := dirs[i]
+			path, _ := extractPath(*dir, th.Name)
+			err := os.Chmod(path, th.FileInfo().Mode().Perm())
+			if err == nil {
+				err = os.Chtimes(path, th.ModTime, th.ModTime)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "huff: %s: %v\n", th.Name, err)
+				failed = true
+			}
+		}
+		if failed {
+			return errSilent
+		}
+		return nil
+	})
+}
+
+// printTarEntry lists th the way tar -tv does.
+func printTarEntry(th *tar.Header) {
+	name := th.Name
+	if th.Typeflag == tar.TypeSymlink {
+		name += " -> " + th.Linkname
+	}
+	fmt.Printf("%s %12d %s %s\n", th.FileInfo().Mode(), th.Size, th.ModTime.Local().Format("2006-01-02 15:04"), name)
+}
+
+// extractTarEntry writes the member th read from tr into dir.
+// Nothing is ever written outside dir, neither through .. in names nor through symbolic links.
+func extractTarEntry(tr *tar.Reader, th *tar.Header, dir string, force bool) error {
+	path, err := extractPath(dir, th.Name)
+	if err != nil {
+		return err
+	}
+	if err := checkParents(dir, path); err != nil {
+		return err
+	}
+	if th.Typeflag == tar.TypeDir {
+		return os.MkdirAll(path, 0o777)
+	}
+	if th.Typeflag != tar.TypeReg && th.Typeflag != tar.TypeSymlink {
+		return errors.New("not a regular file, directory or symbolic link -- ignored")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+		return err
+	}
+	if err := removeExisting(path, force); err != nil {
+		return err
+	}
+	if th.Typeflag == tar.TypeSymlink {
+		return os.Symlink(th.Linkname, path)
+	}
+	return writeFile(path, tr, th.FileInfo().Mode().Perm(), th.ModTime)
+}
+
+// removeExisting removes the file at path so that it can be created anew,
+// or fails without force.
+// Existing files are replaced rather than written to, they could be symbolic links.
+func removeExisting(path string, force bool) error {
+	if _, err := os.Lstat(path); err != nil {
+		return nil
+	}
+	if !force {
+		return fmt.Errorf("%s already exists; use -f to overwrite", path)
+	}
+	return os.Remove(path)
+}
+
+// checkParents makes sure that none of the directories between dir and path
+// is a symbolic link, which could lead out of dir.
+// Directories which don't exist yet are fine.
+func checkParents(dir, path string) error {
+	rel, err := filepath.Rel(dir, filepath.Dir(path))
+	if err != nil || rel == "." {
+		return err
+	}
+	p := dir
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		p = filepath.Join(p, elem)
+		fi, err := os.Lstat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			return errors.New("path through a symbolic link -- ignored")
+		}
+	}
+	return nil
+}
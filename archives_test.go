@@ -0,0 +1,304 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"huffman_coding/huffman"
+)
+
+func TestExtractPath(t *testing.T) {
+	dir := filepath.Join("out", "dir")
+	for _, tt := range []struct {
+		name string
+		want string
+	}{
+		{"a.txt", filepath.Join(dir, "a.txt")},
+		{"sub/a.txt", filepath.Join(dir, "sub", "a.txt")},
+		{"sub/", filepath.Join(dir, "sub")},
+		{"sub/../a.txt", filepath.Join(dir, "a.txt")},
+	} {
+		if got, err := extractPath(dir, tt.name); err != nil || got != tt.want {
+			t.Errorf("extractPath(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	for _, name := range []string{"../x", "sub/../../x", "..", "/x", "/etc/passwd", ""} {
+		if got, err := extractPath(dir, name); err == nil {
+			t.Errorf("extractPath(%q) = %q, want an error", name, got)
+		}
+	}
+}
+
+// writeZipFile writes a zip archive of files, compressed with huffman.ZipMethod, to name.
+func writeZipFile(t *testing.T, name string, files map[string]string) {
+	t.Helper()
+	out, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	zw := zip.NewWriter(out)
+	zw.RegisterCompressor(huffman.ZipMethod, huffman.ZipCompressor(huffman.Options{}))
+	for name, content := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: huffman.ZipMethod})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFile returns the content of the named file, failing the test if it can't be read.
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestUnzipSymlinks(t *testing.T) {
+	tmp := t.TempDir()
+	archive := filepath.Join(tmp, "a.zip")
+	writeZipFile(t, archive, map[string]string{"target.txt": "from the archive", "sub/a.txt": "from the archive"})
+	outside := filepath.Join(tmp, "outside")
+	if err := os.Mkdir(outside, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(outside, "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(tmp, "dir")
+	if err := os.Mkdir(dir, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	// a symbolic link where a file is extracted, and one where a directory is
+	if err := os.Symlink(secret, filepath.Join(dir, "target.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "sub")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runUnzip([]string{"-d", dir, archive}); err == nil {
+		t.Error("unzip over existing files without -f succeeded")
+	}
+	// the planted link is replaced by the file, the linked directory is refused
+	if err := runUnzip([]string{"-f", "-d", dir, archive}); err == nil {
+		t.Error("unzip through a symbolic link to a directory succeeded")
+	}
+	if got := readFile(t, secret); got != "secret" {
+		t.Errorf("file outside the directory overwritten with %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "a.txt")); err == nil {
+		t.Error("file written through a symbolic link to a directory")
+	}
+	fi, err := os.Lstat(filepath.Join(dir, "target.txt"))
+	if err != nil || !fi.Mode().IsRegular() {
+		t.Fatalf("Lstat = %v, %v, want the extracted file", fi, err)
+	}
+	if got := readFile(t, filepath.Join(dir, "target.txt")); got != "from the archive" {
+		t.Errorf("extracted %q", got)
+	}
+}
+
+// chdir changes the working directory until the test ends.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// testTree is the content of the tree archived by the tar tests,
+// by slash separated path: the mode and the content of files, or the target of symbolic links.
+var testTree = []struct {
+	path    string
+	mode    fs.FileMode
+	content string
+}{
+	{"tree", fs.ModeDir | 0o750, ""},
+	{"tree/a.txt", 0o640, "abracadabra"},
+	{"tree/sub", fs.ModeDir | 0o755, ""},
+	{"tree/sub/b.sh", 0o755, "#!/bin/sh\necho abracadabra\n"},
+	{"tree/link", fs.ModeSymlink, "a.txt"},
+}
+
+// testTime is the modification time of everything in testTree, tar keeps whole seconds.
+var testTime = time.Date(2020, 2, 29, 12, 34, 56, 0, time.UTC)
+
+// writeTestTree creates testTree in dir.
+func writeTestTree(t *testing.T, dir string) {
+	t.Helper()
+	for _, e := range testTree {
+		path := filepath.Join(dir, filepath.FromSlash(e.path))
+		var err error
+		switch {
+		case e.mode.IsDir():
+			err = os.Mkdir(path, 0o777)
+		case e.mode&fs.ModeSymlink != 0:
+			err = os.Symlink(e.content, path)
+		default:
+			err = os.WriteFile(path, []byte(e.content), 0o666)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// deepest first, so that setting the times of files doesn't change those of their directories
+	for i := len(testTree) - 1; i >= 0; i-- {
+		e := testTree[i]
+		if e.mode&fs.ModeSymlink != 0 {
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(e.path))
+		if err := os.Chmod(path, e.mode.Perm()); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, testTime, testTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkTestTree checks that the paths of testTree in dir, and nothing else, have been extracted.
+func checkTestTree(t *testing.T, dir string, paths ...string) {
+	t.Helper()
+	want := make(map[string]bool)
+	for _, path := range paths {
+		want[path] = true
+	}
+	for _, e := range testTree {
+		path := filepath.Join(dir, filepath.FromSlash(e.path))
+		fi, err := os.Lstat(path)
+		if !want[e.path] {
+			// directories are created for what is in them
+			if err == nil && !fi.IsDir() && fi.Mode().Type() == e.mode.Type() {
+				t.Errorf("%s extracted", e.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if fi.Mode() != e.mode && !(e.mode&fs.ModeSymlink != 0 && fi.Mode()&fs.ModeSymlink != 0) {
+			t.Errorf("%s: mode %v, want %v", e.path, fi.Mode(), e.mode)
+		}
+		switch {
+		case e.mode&fs.ModeSymlink != 0:
+			if target, err := os.Readlink(path); err != nil || target != e.content {
+				t.Errorf("%s: link to %q, %v, want %q", e.path, target, err, e.content)
+			}
+			continue
+		case e.mode.IsRegular():
+			if got := readFile(t, path); got != e.content {
+				t.Errorf("%s: content %q, want %q", e.path, got, e.content)
+			}
+		}
+		if !fi.ModTime().Equal(testTime) {
+			t.Errorf("%s: modified %v, want %v", e.path, fi.ModTime(), testTime)
+		}
+	}
+}
+
+func TestArchiveExtract(t *testing.T) {
+	tmp := t.TempDir()
+	writeTestTree(t, tmp)
+	chdir(t, tmp)
+	archive := "a" + defaultArchiveSuffix
+	if err := runArchive([]string{"-o", archive, "tree"}); err != nil {
+		t.Fatal(err)
+	}
+
+	all := []string{"tree", "tree/a.txt", "tree/sub", "tree/sub/b.sh", "tree/link"}
+	if err := runExtract([]string{"-d", "all", archive}); err != nil {
+		t.Fatal(err)
+	}
+	checkTestTree(t, "all", all...)
+
+	// members asked for by name, directories with everything in them
+	if err := runExtract([]string{"-d", "some", archive, "tree/sub", "tree/link"}); err != nil {
+		t.Fatal(err)
+	}
+	checkTestTree(t, "some", "tree/sub", "tree/sub/b.sh", "tree/link")
+
+	// existing files are kept without -f
+	changed := filepath.Join("all", "tree", "a.txt")
+	if err := os.WriteFile(changed, []byte("changed"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := runExtract([]string{"-d", "all", archive, "tree/a.txt"}); err == nil {
+		t.Error("extracting over an existing file without -f succeeded")
+	}
+	if got := readFile(t, changed); got != "changed" {
+		t.Errorf("existing file overwritten without -f with %q", got)
+	}
+	if err := runExtract([]string{"-f", "-d", "all", archive}); err != nil {
+		t.Fatal(err)
+	}
+	checkTestTree(t, "all", all...)
+}
+
+func TestExtractSymlinks(t *testing.T) {
+	tmp := t.TempDir()
+	writeTestTree(t, tmp)
+	chdir(t, tmp)
+	archive := "a" + defaultArchiveSuffix
+	if err := runArchive([]string{"-o", archive, "tree/a.txt", "tree/sub"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Mkdir("outside", 0o777); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join("outside", "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	abs, err := filepath.Abs("outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a symbolic link where a file is extracted, and one where a directory is
+	if err := os.MkdirAll(filepath.Join("out", "tree"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(abs, "secret.txt"), filepath.Join("out", "tree", "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(abs, filepath.Join("out", "tree", "sub")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runExtract([]string{"-f", "-d", "out", archive}); err == nil {
+		t.Error("extracting through a symbolic link to a directory succeeded")
+	}
+	if got := readFile(t, secret); got != "secret" {
+		t.Errorf("file outside the directory overwritten with %q", got)
+	}
+	if _, err := os.Lstat(filepath.Join("outside", "b.sh")); err == nil {
+		t.Error("file written through a symbolic link to a directory")
+	}
+	// the planted link is replaced by the file
+	checkTestTree(t, "out", "tree/a.txt")
+}
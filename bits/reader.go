@@ -5,14 +5,29 @@ import (
 	"io"
 )
 
+// byteReader is what a Reader needs from its input.
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
 type Reader struct {
-	in    *bufio.Reader
+	in    byteReader
 	buf   byte
 	count uint8
+	// number of bytes taken from in
+	offset int64
 }
 
+// NewReader returns a Reader reading from in.
+// in is buffered unless it's an io.ByteReader, which is assumed to be buffered already,
+// like *bufio.Reader and *bytes.Reader are. Then nothing is read from it beyond the bits read.
 func NewReader(in io.Reader) *Reader {
-	return &Reader{in: bufio.NewReader(in)}
+	br, ok := in.(byteReader)
+	if !ok {
+		br = bufio.NewReader(in)
+	}
+	return &Reader{in: br}
 }
 
 // Read implements io.Reader and gives a byte-level view of the bit stream.
@@ -21,23 +36,39 @@ func NewReader(in io.Reader) *Reader {
 // Byte boundary can be ensured by calling Align().
 func (r *Reader) Read(p []byte) (n int, err error) {
 	if r.count == 0 {
-		return r.in.Read(p)
+		n, err = r.in.Read(p)
+		r.offset += int64(n)
+		return n, err
 	}
 	for n = range p {
 		if p[n], err = r.readUnalignedByte(); err != nil {
-			return 0, err
+			return n, err
 		}
 	}
-	return n, nil
+	return len(p), nil
 }
 
 func (r *Reader) ReadByte() (b byte, err error) {
 	if r.count == 0 {
-		return r.in.ReadByte()
+		return r.readByte()
 	}
 	return r.readUnalignedByte()
 }
 
+// readByte reads the next byte from the underlying reader.
+func (r *Reader) readByte() (b byte, err error) {
+	if b, err = r.in.ReadByte(); err == nil {
+		r.offset++
+	}
+	return b, err
+}
+
+// Offset returns the number of bytes read from the underlying io.Reader so far,
+// counting a byte as soon as any of its bits has been read.
+func (r *Reader) Offset() int64 {
+	return r.offset
+}
+
 // readUnalignedByte reads the next 8 bits which are unaligned and returns them as a byte
 // bits are read from left to right:
 //
@@ -50,10 +81,11 @@ func (r *Reader) readUnalignedByte() (b byte, err error) {
 	// 00000011 << 6
 	// 11000000
 	b = r.buf << (8 - count)
-	r.buf, err = r.in.ReadByte()
+	next, err := r.readByte()
 	if err != nil {
 		return 0, err
 	}
+	r.buf = next
 	// 11000000 | 11111111 >> 2
 	// 11000000 | 00111111
 	// 11111111
@@ -83,6 +115,7 @@ func (r *Reader) ReadBits(n uint8) (u uint64, err error) {
 		// 00111111 & 00000011
 		// 00000011
 		r.buf &= 1<<shift - 1
+		r.count = shift
 		return u, nil
 	}
 
@@ -98,7 +131,7 @@ func (r *Reader) ReadBits(n uint8) (u uint64, err error) {
 			n -= r.count
 		}
 		for n >= 8 {
-			b, err := r.in.ReadByte()
+			b, err := r.readByte()
 			if err != nil {
 				return 0, err
 			}
@@ -112,38 +145,41 @@ func (r *Reader) ReadBits(n uint8) (u uint64, err error) {
 		// read last bits if any
 		// 6 > 0
 		if n > 0 {
-			if r.buf, err = r.in.ReadByte(); err != nil {
-				// 2 = 8 - 6
-				shift := 8 - n
-				// 00000000 ... 01111111 11111111 << 6 + uint64(11111111>>2)
-				// 00000000 ... 01111111 11111111 << 6 + uint64(00111111)
-				// 00000000 ... 01111111 11111111 << 6 + 00000000 ... 00111111
-				// 00000000 ... 00011111 11111111 11000000 + 00000000 ... 00111111
-				// 00000000 ... 00011111 11111111 11111111
-				u = u<<n + uint64(r.buf>>shift)
-				// 11111111 & 1<<2 - 1
-				// 11111111 & 00000100 - 1
-				// 11111111 & 00000011
-				// 00000011
-				r.buf &= 1<<shift - 1
-				r.count = shift
+			b, err := r.readByte()
+			if err != nil {
+				return 0, err
 			}
+			r.buf = b
+			// 2 = 8 - 6
+			shift := 8 - n
+			// 00000000 ... 01111111 11111111 << 6 + uint64(11111111>>2)
+			// 00000000 ... 01111111 11111111 << 6 + uint64(00111111)
+			// 00000000 ... 01111111 11111111 << 6 + 00000000 ... 00111111
+			// 00000000 ... 00011111 11111111 11000000 + 00000000 ... 00111111
+			// 00000000 ... 00011111 11111111 11111111
+			u = u<<n + uint64(r.buf>>shift)
+			// 11111111 & 1<<2 - 1
+			// 11111111 & 00000100 - 1
+			// 11111111 & 00000011
+			// 00000011
+			r.buf &= 1<<shift - 1
+			r.count = shift
 		} else {
-			r.count = 0
+			r.buf, r.count = 0, 0
 		}
 		return u, nil
 	}
 
 	// buffer has exactly as many bits as needed
-	// no need to clear buffer since it will be overwritten on the next read
-	r.count = 0
-	return uint64(r.buf), nil
+	u = uint64(r.buf)
+	r.buf, r.count = 0, 0
+	return u, nil
 }
 
 // ReadOneBit reads one bit from buffer from left to right ([1]1111111 -> 0[1]111111 -> 00111111)
 func (r *Reader) ReadOneBit() (b bool, err error) {
 	if r.count == 0 {
-		r.buf, err = r.in.ReadByte()
+		r.buf, err = r.readByte()
 		if err != nil {
 			return false, err
 		}
@@ -0,0 +1,87 @@
+package bits
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestReadBits(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		// bits to read, one call each
+		reads []uint8
+		want  []uint64
+		// bits left in the buffer after the last read
+		count uint8
+	}{
+		{"fewer than buffered", []byte{0b10110011}, []uint8{2, 3, 1}, []uint64{0b10, 0b110, 0}, 2},
+		{"exactly buffered", []byte{0b10110011}, []uint8{3, 5}, []uint64{0b101, 0b10011}, 0},
+		{"whole bytes", []byte{0xab, 0xcd}, []uint8{8, 8}, []uint64{0xab, 0xcd}, 0},
+		{"more than buffered", []byte{0b10110011, 0b01011100}, []uint8{3, 9}, []uint64{0b101, 0b100110101}, 4},
+		{"more than buffered in whole bytes", []byte{0xff, 0x12, 0x34}, []uint8{4, 20}, []uint64{0xf, 0xf1234}, 0},
+		{"more than buffered with bits left", []byte{0xff, 0x12, 0x34}, []uint8{4, 12, 2}, []uint64{0xf, 0xf12, 0}, 6},
+		{"empty buffer", []byte{0x12, 0x34, 0x56}, []uint8{12, 12}, []uint64{0x123, 0x456}, 0},
+		{"64 bits", []byte{1, 2, 3, 4, 5, 6, 7, 8}, []uint8{64}, []uint64{0x0102030405060708}, 0},
+		{"64 bits unaligned", []byte{0x81, 2, 3, 4, 5, 6, 7, 8, 0x9f}, []uint8{1, 64}, []uint64{1, 0x020406080a0c0e11}, 7},
+		{"nothing", []byte{0xff}, []uint8{0, 3, 0}, []uint64{0, 0b111, 0}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(bytes.NewReader(tt.input))
+			for i, n := range tt.reads {
+				got, err := r.ReadBits(n)
+				if err != nil {
+					t.Fatalf("read %d of %d bits: %v", i, n, err)
+				}
+				if got != tt.want[i] {
+					t.Errorf("read %d of %d bits = %#b, want %#b", i, n, got, tt.want[i])
+				}
+			}
+			if r.count != tt.count {
+				t.Errorf("%d bits left, want %d", r.count, tt.count)
+			}
+		})
+	}
+}
+
+func TestReadBitsEOF(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		// bits read before the one failing
+		before uint8
+		n      uint8
+	}{
+		{"empty input", nil, 0, 1},
+		{"whole byte missing", []byte{0xff}, 4, 12},
+		{"last bits missing", []byte{0xff, 0xff}, 4, 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(bytes.NewReader(tt.input))
+			if _, err := r.ReadBits(tt.before); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := r.ReadBits(tt.n); err != io.EOF {
+				t.Errorf("ReadBits(%d) error = %v, want io.EOF", tt.n, err)
+			}
+		})
+	}
+}
+
+func TestReaderOffset(t *testing.T) {
+	r := NewReader(bytes.NewReader([]byte{1, 2, 3}))
+	for _, step := range []struct {
+		bits   uint8
+		offset int64
+	}{{0, 0}, {1, 1}, {7, 1}, {9, 3}} {
+		if _, err := r.ReadBits(step.bits); err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Offset(); got != step.offset {
+			t.Errorf("Offset() = %d after %d bits, want %d", got, step.bits, step.offset)
+		}
+	}
+}
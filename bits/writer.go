@@ -5,16 +5,29 @@ import (
 	"io"
 )
 
+// byteWriter is what a Writer needs from its output.
+type byteWriter interface {
+	io.Writer
+	io.ByteWriter
+}
+
 type Writer struct {
-	out *bufio.Writer
+	out byteWriter
 	// bits buffer
 	buf byte
 	// number of bits written to buffer
 	count uint8
 }
 
+// NewWriter returns a Writer writing to out.
+// out is buffered unless it's an io.ByteWriter, which is assumed to be buffered already,
+// like *bufio.Writer and *bytes.Buffer are.
 func NewWriter(out io.Writer) *Writer {
-	return &Writer{out: bufio.NewWriter(out)}
+	bw, ok := out.(byteWriter)
+	if !ok {
+		bw = bufio.NewWriter(out)
+	}
+	return &Writer{out: bw}
 }
 
 // Write implements io.Writer and gives a byte-level interface to the bit stream.
@@ -225,9 +238,18 @@ func (w *Writer) Align() (unset uint8, err error) {
 	return unset, nil
 }
 
+// Flush writes the complete bytes written so far to the underlying io.Writer.
+// Bits of an incomplete byte stay buffered, Align writes them as well.
+func (w *Writer) Flush() error {
+	if bw, ok := w.out.(*bufio.Writer); ok {
+		return bw.Flush()
+	}
+	return nil
+}
+
 func (w *Writer) Close() error {
 	if _, err := w.Align(); err != nil {
 		return err
 	}
-	return w.out.Flush()
+	return w.Flush()
 }
@@ -0,0 +1,712 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"huffman_coding/huffman"
+)
+
+const defaultSuffix = huffman.Suffix
+
+// fileFlags are the flags shared by the commands that turn one file into another.
+type fileFlags struct {
+	stdout bool
+	force  bool
+	keep   bool
+	suffix string
+}
+
+func (f *fileFlags) register(set *flag.FlagSet) {
+	set.BoolVar(&f.stdout, "c", false, "write to standard output, keep the source files")
+	set.BoolVar(&f.force, "f", false, "overwrite existing output files")
+	set.BoolVar(&f.keep, "k", false, "keep the source files")
+	set.StringVar(&f.suffix, "S", defaultSuffix, "suffix of compressed files")
+}
+
+// Default limits of the commands decompressing data.
+const (
+	defaultMaxSize  = 16 << 30
+	defaultMaxRatio = 1000
+)
+
+// limitFlags are the limits of the commands decompressing data,
+// protecting against small inputs decompressing to huge outputs.
+type limitFlags struct {
+	maxSize  int64
+	maxRatio float64
+}
+
+func (l *limitFlags) register(set *flag.FlagSet) {
+	set.Int64Var(&l.maxSize, "max-size", defaultMaxSize, "fail instead of decompressing more than `n` bytes per input, 0 for no limit")
+	set.Float64Var(&l.maxRatio, "max-ratio", defaultMaxRatio, "fail instead of decompressing more than `r` times the compressed size, 0 for no limit")
+}
+
+// options returns opts with the limits set.
+func (l *limitFlags) options(opts huffman.Options) huffman.Options {
+	opts.MaxSize, opts.MaxRatio = l.maxSize, l.maxRatio
+	return opts
+}
+
+// limitHint adds the flags raising the limits to errors about exceeding them.
+func limitHint(err error) error {
+	if errors.Is(err, huffman.ErrLimitExceeded) {
+		return fmt.Errorf("%w; use -max-size or -max-ratio to raise the limits", err)
+	}
+	return err
+}
+
+// newFlagSet returns a flag set for the named command.
+// Parsing errors make the program exit with exitUsage.
+func newFlagSet(name, args string) *flag.FlagSet {
+	set := flag.NewFlagSet(name, flag.ExitOnError)
+	set.Usage = func() {
+		fmt.Fprintf(set.Output(), "usage: huff %s %s\n", name, args)
+		set.PrintDefaults()
+	}
+	return set
+}
+
+// forEachFile calls fn for every name, reporting the errors as they happen.
+// No names at all means standard input.
+// Returns errSilent if fn failed for any of the names.
+func forEachFile(names []string, fn func(name string) error) error {
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	failed := false
+	for _, name := range names {
+		if err := fn(name); err != nil {
+			fmt.Fprintf(os.Stderr, "huff: %s: %v\n", name, err)
+			failed = true
+		}
+	}
+	if failed {
+		return errSilent
+	}
+	return nil
+}
+
+// withInput opens the named file, or standard input for "-", and passes it to fn.
+func withInput(name string, fn func(in io.Reader) error) error {
+	if name == "-" {
+		return fn(os.Stdin)
+	}
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return fn(in)
+}
+
+func runCompress(args []string) error {
+	set := newFlagSet("compress", "[-c] [-f] [-k] [-S suffix] [-m method] [-preseed] [-dict file] [-size] [files...]")
+	var ff fileFlags
+	ff.register(set)
+	methodName := set.String("m", "huffman", "coding method: "+methodNames())
+	preseed := set.Bool("preseed", false, "start the model with all bytes seen once, better for short inputs")
+	dictName := set.String("dict", "", "prime the model with the dictionary `file` made by train")
+	recordSize := set.Bool("size", false, "record the size of regular files, which must not change while being compressed")
+	set.Parse(args)
+
+	dict, err := loadDictionary(*dictName)
+	if err != nil {
+		return err
+	}
+	opts := huffman.Options{Method: parseMethod(set, *methodName), Preseed: *preseed, Dictionary: dict}
+	fn := func(dst io.Writer, src io.Reader) error {
+		opts := opts
+		if *recordSize {
+			opts.Size = regularSize(src)
+		}
+		return compress(dst, src, opts)
+	}
+
+	return forEachFile(set.Args(), func(name string) error {
+		if name == "-" {
+			return fn(os.Stdout, os.Stdin)
+		}
+		if !ff.stdout && strings.HasSuffix(name, ff.suffix) {
+			return fmt.Errorf("already has %s suffix -- unchanged", ff.suffix)
+		}
+		return transformFile(name, name+ff.suffix, ff, fn)
+	})
+}
+
+func runDecompress(args []string) error {
+	set := newFlagSet("decompress", "[-c] [-f] [-k] [-S suffix] [-dict file] [-max-size n] [-max-ratio r] [files...]")
+	var ff fileFlags
+	ff.register(set)
+	var lf limitFlags
+	lf.register(set)
+	dictName := set.String("dict", "", "dictionary `file` the inputs were compressed with")
+	set.Parse(args)
+
+	dict, err := loadDictionary(*dictName)
+	if err != nil {
+		return err
+	}
+	opts := lf.options(huffman.Options{Dictionary: dict})
+	fn := func(dst io.Writer, src io.Reader) error {
+		return decompress(dst, src, opts)
+	}
+
+	return forEachFile(set.Args(), func(name string) error {
+		if name == "-" {
+			return fn(os.Stdout, os.Stdin)
+		}
+		outName := strings.TrimSuffix(name, ff.suffix)
+		if !ff.stdout && (outName == name || outName == "") {
+			return errors.New("unknown suffix -- ignored")
+		}
+		return transformFile(name, outName, ff, fn)
+	})
+}
+
+func runTest(args []string) error {
+	set := newFlagSet("test", "[-v] [-dict file] [-max-size n] [-max-ratio r] [files...]")
+	verbose := set.Bool("v", false, "report every file that passed")
+	var lf limitFlags
+	lf.register(set)
+	dictName := set.String("dict", "", "dictionary `file` the inputs were compressed with")
+	set.Parse(args)
+
+	dict, err := loadDictionary(*dictName)
+	if err != nil {
+		return err
+	}
+	opts := lf.options(huffman.Options{Dictionary: dict})
+	return forEachFile(set.Args(), func(name string) error {
+		return withInput(name, func(in io.Reader) error {
+			if err := decompress(io.Discard, in, opts); err != nil {
+				return err
+			}
+			if *verbose {
+				fmt.Printf("%s: OK\n", name)
+			}
+			return nil
+		})
+	})
+}
+
+func runInfo(args []string) error {
+	set := newFlagSet("info", "[-json] [-raw] [-S suffix] [-dict file] [-max-size n] [-max-ratio r] [files...]")
+	asJSON := set.Bool("json", false, "print the statistics as JSON")
+	raw := set.Bool("raw", false, "treat all inputs as uncompressed data")
+	suffix := set.String("S", defaultSuffix, "suffix of compressed files")
+	var lf limitFlags
+	lf.register(set)
+	dictName := set.String("dict", "", "dictionary `file` the inputs were or are to be compressed with")
+	set.Parse(args)
+
+	dict, err := loadDictionary(*dictName)
+	if err != nil {
+		return err
+	}
+	opts := huffman.Options{Dictionary: dict}
+	// Files with the suffix and standard input are compressed data,
+	// anything else is analyzed by compressing it.
+	enc := json.NewEncoder(os.Stdout)
+	return forEachFile(set.Args(), func(name string) error {
+		return withInput(name, func(in io.Reader) error {
+			var st *huffman.Stats
+			var err error
+			if *raw || (name != "-" && !strings.HasSuffix(name, *suffix)) {
+				st, err = huffman.AnalyzeOptions(in, opts)
+			} else {
+				st, err = huffman.AnalyzeCompressedOptions(in, lf.options(opts))
+			}
+			if err != nil {
+				return limitHint(err)
+			}
+			if *asJSON {
+				return enc.Encode(struct {
+					Name string `json:"name"`
+					*huffman.Stats
+				}{name, st})
+			}
+			printStats(os.Stdout, name, st)
+			return nil
+		})
+	})
+}
+
+// printStats writes the human-readable form of st to w.
+func printStats(w io.Writer, name string, st *huffman.Stats) {
+	fmt.Fprintf(w, "%s:\n", name)
+	fmt.Fprintf(w, "  method:         %s\n", st.Method)
+	fmt.Fprintf(w, "  uncompressed:   %d bytes\n", st.Uncompressed)
+	fmt.Fprintf(w, "  compressed:     %d bytes (%s saved)\n", st.Compressed, ratio(st.Compressed, st.Uncompressed))
+	fmt.Fprintf(w, "  entropy:        %.4f bits/byte\n", st.Entropy)
+	fmt.Fprintf(w, "  average code:   %.4f bits/byte\n", st.AverageLength)
+	fmt.Fprintf(w, "  redundancy:     %.4f bits/byte\n", st.Redundancy)
+	fmt.Fprintf(w, "  achieved:       %.4f bits/byte\n", st.BitsPerByte)
+	fmt.Fprintf(w, "\n  %-10s %12s %4s  %s\n", "symbol", "freq", "len", "code")
+	for _, sym := range st.Symbols {
+		fmt.Fprintf(w, "  %-10s %12d %4d  %s\n", sym.Name(), sym.Freq, sym.Length, sym.Code)
+	}
+}
+
+func runTree(args []string) error {
+	set := newFlagSet("tree", "[-format dot|json] [-at n] [-raw] [-S suffix] [-dict file] [-max-size n] [-max-ratio r] [files...]")
+	format := set.String("format", "dot", "output format: dot or json")
+	at := set.Int64("at", 0, "export the adaptive tree after the first n bytes of data instead of all of it")
+	raw := set.Bool("raw", false, "treat all inputs as uncompressed data")
+	suffix := set.String("S", defaultSuffix, "suffix of compressed files")
+	var lf limitFlags
+	lf.register(set)
+	dictName := set.String("dict", "", "dictionary `file` the inputs were or are to be compressed with")
+	set.Parse(args)
+
+	if *format != "dot" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "huff tree: unknown format %q\n", *format)
+		set.Usage()
+		os.Exit(exitUsage)
+	}
+	dict, err := loadDictionary(*dictName)
+	if err != nil {
+		return err
+	}
+	opts := huffman.Options{Dictionary: dict}
+
+	// inputs are told apart the same way info does
+	return forEachFile(set.Args(), func(name string) error {
+		return withInput(name, func(in io.Reader) error {
+			var root *huffman.Node
+			if *raw || (name != "-" && !strings.HasSuffix(name, *suffix)) {
+				w := huffman.NewWriterOptions(io.Discard, opts)
+				if err := copyUpTo(w, in, *at); err != nil {
+					return err
+				}
+				root = w.Root()
+			} else {
+				r := huffman.NewReaderOptions(in, lf.options(opts))
+				if err := copyUpTo(io.Discard, r, *at); err != nil {
+					return limitHint(err)
+				}
+				root = r.Root()
+			}
+
+			if *format == "json" {
+				return json.NewEncoder(os.Stdout).Encode(root)
+			}
+			return root.WriteDOT(os.Stdout)
+		})
+	})
+}
+
+func runTrace(args []string) error {
+	set := newFlagSet("trace", "[-raw] [-S suffix] [-m method] [-dict file] [-max-size n] [-max-ratio r] [files...]")
+	raw := set.Bool("raw", false, "treat all inputs as uncompressed data")
+	suffix := set.String("S", defaultSuffix, "suffix of compressed files")
+	methodName := set.String("m", "huffman", "coding method used to encode uncompressed inputs: "+methodNames())
+	var lf limitFlags
+	lf.register(set)
+	dictName := set.String("dict", "", "dictionary `file` the inputs were or are to be compressed with")
+	set.Parse(args)
+
+	dict, err := loadDictionary(*dictName)
+	if err != nil {
+		return err
+	}
+	opts := huffman.Options{Method: parseMethod(set, *methodName), Dictionary: dict}
+	// Uncompressed inputs are traced while encoding them, compressed ones while decoding them.
+	// Inputs are told apart the same way info does.
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	trace := func(e huffman.TraceEvent) {
+		fmt.Fprintln(out, e)
+	}
+	return forEachFile(set.Args(), func(name string) error {
+		return withInput(name, func(in io.Reader) error {
+			fmt.Fprintln(out, huffman.TraceHeader)
+			if *raw || (name != "-" && !strings.HasSuffix(name, *suffix)) {
+				w := huffman.NewWriterOptions(io.Discard, opts)
+				w.SetTrace(trace)
+				if _, err := io.Copy(w, in); err != nil {
+					return err
+				}
+				return w.Close()
+			}
+			r := huffman.NewReaderOptions(in, lf.options(huffman.Options{Dictionary: dict}))
+			r.SetTrace(trace)
+			_, err := io.Copy(io.Discard, r)
+			return limitHint(err)
+		})
+	})
+}
+
+func runDiff(args []string) error {
+	set := newFlagSet("diff", "trace1 trace2")
+	set.Parse(args)
+	if set.NArg() != 2 {
+		set.Usage()
+		os.Exit(exitUsage)
+	}
+
+	a, err := os.Open(set.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	b, err := os.Open(set.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	d, err := diffTraces(a, b)
+	if err != nil {
+		return err
+	}
+	if d == "" {
+		return nil
+	}
+	fmt.Print(d)
+	// differences are reported like diff does, by the exit code
+	return errSilent
+}
+
+// diffTraces compares the traces read from a and b event by event
+// and describes the first step where they disagree.
+// Returns an empty string if the traces are the same.
+func diffTraces(a, b io.Reader) (string, error) {
+	sa, sb := newTraceScanner(a), newTraceScanner(b)
+	for {
+		ea, okA, err := sa.next()
+		if err != nil {
+			return "", err
+		}
+		eb, okB, err := sb.next()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case !okA && !okB:
+			return "", nil
+		case !okA:
+			return fmt.Sprintf("first trace ends before symbol %d\n  2: %v\n", eb.Index, eb), nil
+		case !okB:
+			return fmt.Sprintf("second trace ends before symbol %d\n  1: %v\n", ea.Index, ea), nil
+		case ea != eb:
+			return fmt.Sprintf("traces differ at symbol %d (%s)\n  1: %v\n  2: %v\n",
+				ea.Index, traceEventDiff(ea, eb), ea, eb), nil
+		}
+	}
+}
+
+// traceEventDiff lists the names of the fields which differ between a and b.
+func traceEventDiff(a, b huffman.TraceEvent) string {
+	var fields []string
+	for _, f := range []struct {
+		name  string
+		equal bool
+	}{
+		{"index", a.Index == b.Index},
+		{"offset", a.Offset == b.Offset},
+		{"char", a.Char == b.Char},
+		{"new", a.New == b.New},
+		{"code", a.Code == b.Code && a.Length == b.Length},
+		{"hash", a.Hash == b.Hash},
+	} {
+		if !f.equal {
+			fields = append(fields, f.name)
+		}
+	}
+	return strings.Join(fields, ", ") + " differ"
+}
+
+// traceScanner reads trace events line by line, skipping comments and empty lines.
+type traceScanner struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newTraceScanner(r io.Reader) *traceScanner {
+	return &traceScanner{s: bufio.NewScanner(r)}
+}
+
+// next returns the next event, or ok set to false at the end of the trace.
+func (t *traceScanner) next() (e huffman.TraceEvent, ok bool, err error) {
+	for t.s.Scan() {
+		t.line++
+		line := t.s.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if e, err = huffman.ParseTraceEvent(line); err != nil {
+			return e, false, fmt.Errorf("line %d: %w", t.line, err)
+		}
+		return e, true, nil
+	}
+	return e, false, t.s.Err()
+}
+
+func runCompare(args []string) error {
+	set := newFlagSet("compare", "[files...]")
+	set.Parse(args)
+
+	methods := huffman.Methods()
+	fmt.Printf("%12s", "uncompressed")
+	for _, m := range methods {
+		fmt.Printf(" %12s %6s", m, "bits/B")
+	}
+	fmt.Println("  name")
+	return forEachFile(set.Args(), func(name string) error {
+		// every method needs its own pass, so standard input is read into memory
+		var data []byte
+		err := withInput(name, func(in io.Reader) (err error) {
+			data, err = io.ReadAll(in)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%12d", len(data))
+		for _, m := range methods {
+			cw := &countingWriter{w: io.Discard}
+			if err := compress(cw, bytes.NewReader(data), huffman.Options{Method: m}); err != nil {
+				return err
+			}
+			bpb := 0.0
+			if len(data) > 0 {
+				bpb = 8 * float64(cw.n) / float64(len(data))
+			}
+			fmt.Printf(" %12d %6.3f", cw.n, bpb)
+		}
+		fmt.Printf("  %s\n", name)
+		return nil
+	})
+}
+
+func runTrain(args []string) error {
+	set := newFlagSet("train", "[-o file] [-contexts] [files...]")
+	outName := set.String("o", "-", "write the dictionary to `file`")
+	contexts := set.Bool("contexts", false, "add order-1 tables of the bytes following every byte")
+	set.Parse(args)
+
+	// every file is a sample of its own
+	var samples [][]byte
+	err := forEachFile(set.Args(), func(name string) error {
+		return withInput(name, func(in io.Reader) error {
+			data, err := io.ReadAll(in)
+			samples = append(samples, data)
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	train := huffman.Train
+	if *contexts {
+		train = huffman.TrainContexts
+	}
+	dict := train(samples)
+	data, err := dict.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if *outName == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*outName, data, 0o666); err != nil {
+		return err
+	}
+	fmt.Printf("%s: dictionary %08x of %d samples\n", *outName, dict.ID(), len(samples))
+	return nil
+}
+
+// loadDictionary reads the named dictionary file written by train.
+// An empty name means no dictionary.
+func loadDictionary(name string) (*huffman.Dictionary, error) {
+	if name == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	dict := new(huffman.Dictionary)
+	if err := dict.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return dict, nil
+}
+
+// parseMethod returns the method of the given name,
+// exiting with a usage error if there's no such method.
+func parseMethod(set *flag.FlagSet, name string) huffman.Method {
+	m, err := huffman.ParseMethod(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "huff %s: %v\n", set.Name(), err)
+		set.Usage()
+		os.Exit(exitUsage)
+	}
+	return m
+}
+
+// methodNames returns the names of all methods for flag descriptions.
+func methodNames() string {
+	var names []string
+	for _, m := range huffman.Methods() {
+		names = append(names, m.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// copyUpTo copies n bytes from src to dst, or everything if n is not positive.
+// Reaching the end of src before n bytes is not an error.
+func copyUpTo(dst io.Writer, src io.Reader, n int64) error {
+	var err error
+	if n > 0 {
+		_, err = io.CopyN(dst, src, n)
+	} else {
+		_, err = io.Copy(dst, src)
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+func runCat(args []string) error {
+	set := newFlagSet("cat", "[-dict file] [-max-size n] [-max-ratio r] [files...]")
+	var lf limitFlags
+	lf.register(set)
+	dictName := set.String("dict", "", "dictionary `file` the inputs were compressed with")
+	set.Parse(args)
+
+	dict, err := loadDictionary(*dictName)
+	if err != nil {
+		return err
+	}
+	opts := lf.options(huffman.Options{Dictionary: dict})
+	return forEachFile(set.Args(), func(name string) error {
+		return withInput(name, func(in io.Reader) error {
+			return decompress(os.Stdout, in, opts)
+		})
+	})
+}
+
+// transformFile writes the result of fn applied to the named file into outName,
+// or to standard output if ff.stdout is set.
+// Output files get the mode and modification time of the source,
+// and the source is removed afterwards unless ff.keep is set.
+// Existing output files are never overwritten without ff.force.
+func transformFile(name, outName string, ff fileFlags, fn func(dst io.Writer, src io.Reader) error) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return errors.New("not a regular file -- ignored")
+	}
+
+	if ff.stdout {
+		return fn(os.Stdout, in)
+	}
+
+	out, err := createOutput(outName, fi.Mode().Perm(), ff.force)
+	if err != nil {
+		return err
+	}
+
+	err = fn(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(outName, fi.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Chtimes(outName, fi.ModTime(), fi.ModTime())
+	}
+	if err != nil {
+		// never leave a partial output behind
+		os.Remove(outName)
+		return err
+	}
+
+	if ff.keep {
+		return nil
+	}
+	return os.Remove(name)
+}
+
+// createOutput creates the named output file with the given permissions,
+// the file must not exist unless force is set.
+func createOutput(name string, perm fs.FileMode, force bool) (*os.File, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	out, err := os.OpenFile(name, flags, perm)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, fmt.Errorf("%s already exists; use -f to overwrite", name)
+	}
+	return out, err
+}
+
+// regularSize returns the size of src if it's a regular file other than standard input, or else 0.
+func regularSize(src io.Reader) int64 {
+	if f, ok := src.(*os.File); ok && f != os.Stdin {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			return fi.Size()
+		}
+	}
+	return 0
+}
+
+// compress writes the coded form of src to dst.
+// Data is streamed, so memory use doesn't depend on the size of src.
+func compress(dst io.Writer, src io.Reader, opts huffman.Options) error {
+	w := huffman.NewWriterOptions(dst, opts)
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// decompress writes the decoded form of the Huffman coded src to dst.
+// Data is streamed, so memory use doesn't depend on the size of src.
+func decompress(dst io.Writer, src io.Reader, opts huffman.Options) error {
+	_, err := io.Copy(dst, huffman.NewReaderOptions(src, opts))
+	return limitHint(err)
+}
+
+// ratio returns the space saving of compressed over uncompressed in percents, the way gzip -l does.
+func ratio(compressed, uncompressed int64) string {
+	if uncompressed == 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*(1-float64(compressed)/float64(uncompressed)))
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
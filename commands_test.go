@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"huffman_coding/huffman"
+)
+
+// lcg generates an endless stream of pseudo-random lowercase letters,
+// skewed enough to be compressible.
+type lcg struct {
+	state uint64
+}
+
+func (g *lcg) Read(p []byte) (int, error) {
+	for i := range p {
+		g.state = g.state*6364136223846793005 + 1442695040888963407
+		// the sum of two small uniform values is more likely in the middle
+		p[i] = 'a' + byte(g.state>>60) + byte(g.state>>56&0xf)
+	}
+	return len(p), nil
+}
+
+// verifyingWriter checks that what is written to it matches want.
+type verifyingWriter struct {
+	want io.Reader
+	buf  []byte
+	n    int64
+}
+
+func (w *verifyingWriter) Write(p []byte) (int, error) {
+	if cap(w.buf) < len(p) {
+		w.buf = make([]byte, len(p))
+	}
+	want := w.buf[:len(p)]
+	if _, err := io.ReadFull(w.want, want); err != nil {
+		return 0, fmt.Errorf("%d more bytes than written: %v", len(p), err)
+	}
+	if i := mismatch(p, want); i >= 0 {
+		return 0, fmt.Errorf("byte %d differs", w.n+int64(i))
+	}
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+func mismatch(a, b []byte) int {
+	for i := range a {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return -1
+}
+
+// maxHeapGrowth returns a function stopping the sampling of the heap started by calling maxHeapGrowth,
+// and returning the most it has grown.
+func maxHeapGrowth() (stop func() uint64) {
+	var ms runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	start, peak := ms.HeapAlloc, ms.HeapAlloc
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				runtime.ReadMemStats(&ms)
+				peak = max(peak, ms.HeapAlloc)
+			}
+		}
+	}()
+	return func() uint64 {
+		close(done)
+		wg.Wait()
+		return peak - start
+	}
+}
+
+// streamingEnv names the environment variable which makes TestStreaming stream gigabytes.
+// The adaptive methods code a few MB/s, so that takes the better part of an hour.
+const streamingEnv = "HUFF_TEST_STREAMING"
+
+func TestStreaming(t *testing.T) {
+	if testing.Short() {
+		t.Skip("streams megabytes")
+	}
+	size := int64(4 << 20)
+	if os.Getenv(streamingEnv) != "" {
+		size = 4 << 30
+	} else {
+		t.Logf("set %s=1 to stream 4 GiB per method", streamingEnv)
+	}
+	// well above the buffers of the streams, far below anything proportional to the data
+	const heapLimit = 32 << 20
+	for _, method := range []huffman.Method{huffman.Huffman, huffman.Range, huffman.RANS} {
+		t.Run(method.String(), func(t *testing.T) {
+			stop := maxHeapGrowth()
+			pr, pw := io.Pipe()
+			compressed := make(chan error, 1)
+			go func() {
+				err := compress(pw, io.LimitReader(&lcg{state: 1}, size), huffman.Options{Method: method})
+				pw.CloseWithError(err)
+				compressed <- err
+			}()
+			vw := &verifyingWriter{want: &lcg{state: 1}}
+			err := decompress(vw, pr, huffman.Options{})
+			growth := stop()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := <-compressed; err != nil {
+				t.Fatal(err)
+			}
+			if vw.n != size {
+				t.Errorf("decompressed %d bytes, want %d", vw.n, size)
+			}
+			if growth > heapLimit {
+				t.Errorf("heap grew by %d bytes, want at most %d", growth, heapLimit)
+			}
+		})
+	}
+}
+
+func TestCompressSmall(t *testing.T) {
+	for _, method := range []huffman.Method{huffman.Huffman, huffman.Range, huffman.RANS} {
+		var compressed, decompressed bytes.Buffer
+		input := []byte("abracadabra")
+		if err := compress(&compressed, bytes.NewReader(input), huffman.Options{Method: method}); err != nil {
+			t.Fatal(err)
+		}
+		if err := decompress(&decompressed, &compressed, huffman.Options{}); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decompressed.Bytes(), input) {
+			t.Errorf("%s: got %q, want %q", method, decompressed.Bytes(), input)
+		}
+	}
+}
+
+func TestCompressSize(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a.txt")
+	input := []byte("abracadabra")
+	for _, tt := range []struct {
+		args []string
+		size int64
+	}{
+		{nil, -1},
+		{[]string{"-size"}, int64(len(input))},
+	} {
+		if err := os.WriteFile(name, input, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := runCompress(append(tt.args, name)); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(name + defaultSuffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size, err := huffman.NewReader(f).Size()
+		f.Close()
+		os.Remove(name + defaultSuffix)
+		if err != nil || size != tt.size {
+			t.Errorf("compress %v: recorded size %d, %v, want %d", tt.args, size, err, tt.size)
+		}
+	}
+}
+
+// discardStdout sends what the test writes to standard output to a file, until the test ends.
+func discardStdout(t *testing.T) {
+	t.Helper()
+	f, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = f
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		f.Close()
+	})
+}
+
+// captureStdout returns what run writes to standard output.
+func captureStdout(t *testing.T, run func() error) string {
+	t.Helper()
+	f, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stdout := os.Stdout
+	os.Stdout = f
+	err = run()
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatal(err)
+	}
+	return readFile(t, f.Name())
+}
+
+// writeCompressed compresses data with opts into the named file.
+func writeCompressed(t *testing.T, name string, data []byte, opts huffman.Options) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := compress(&buf, bytes.NewReader(data), opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAnalysisLimits(t *testing.T) {
+	discardStdout(t)
+	bomb := filepath.Join(t.TempDir(), "bomb"+defaultSuffix)
+	// past the allowance of -max-ratio, which it exceeds eightfold
+	writeCompressed(t, bomb, make([]byte, 5<<18), huffman.Options{})
+	commands := map[string]func(args []string) error{"info": runInfo, "tree": runTree, "trace": runTrace}
+	for name, run := range commands {
+		for _, args := range [][]string{{"-max-size", "1000"}, {"-max-ratio", "2"}} {
+			if err := run(append(args, bomb)); err == nil {
+				t.Errorf("%s %v decompressed it all", name, args)
+			}
+		}
+		if err := run([]string{"-max-size", "0", "-max-ratio", "0", bomb}); err != nil {
+			t.Errorf("%s without limits: %v", name, err)
+		}
+	}
+}
+
+func TestAnalysisDictionary(t *testing.T) {
+	discardStdout(t)
+	dir := t.TempDir()
+	sample := []byte("abracadabra, abracadabra! the quick brown fox jumps over the lazy dog")
+	dict := huffman.Train([][]byte{sample})
+	data, err := dict.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dictName := filepath.Join(dir, "dict")
+	if err := os.WriteFile(dictName, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "a.txt"+defaultSuffix)
+	writeCompressed(t, name, sample, huffman.Options{Dictionary: dict})
+
+	commands := map[string]func(args []string) error{"info": runInfo, "tree": runTree, "trace": runTrace}
+	for cmd, run := range commands {
+		if err := run([]string{name}); err == nil {
+			t.Errorf("%s read a dictionary stream without the dictionary", cmd)
+		}
+		if err := run([]string{"-dict", dictName, name}); err != nil {
+			t.Errorf("%s -dict: %v", cmd, err)
+		}
+	}
+}
+
+func TestTraceDiff(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a.txt")
+	input := []byte("abracadabra, abracadabra! the quick brown fox jumps over the lazy dog")
+	if err := os.WriteFile(name, input, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range []huffman.Method{huffman.Huffman, huffman.Range} {
+		writeCompressed(t, name+defaultSuffix, input, huffman.Options{Method: method})
+		// the encoder and the decoder of the same data trace the same
+		encoded := captureStdout(t, func() error { return runTrace([]string{"-m", method.String(), name}) })
+		decoded := captureStdout(t, func() error { return runTrace([]string{name + defaultSuffix}) })
+		if d, err := diffTraces(strings.NewReader(encoded), strings.NewReader(decoded)); err != nil || d != "" {
+			t.Errorf("%s: traces differ: %s, %v", method, d, err)
+		}
+	}
+
+	// the event of 'a' at index 2 changed field by field
+	trace := "# comment\n\n" +
+		"0\t0\t97\ttrue\t1\t0\t0000000000000001\t'a'\n" +
+		"1\t9\t98\ttrue\t2\t10\t0000000000000002\t'b'\n" +
+		"2\t19\t97\tfalse\t2\t11\t0000000000000003\t'a'\n"
+	for _, tt := range []struct {
+		other string
+		want  string
+	}{
+		{trace, ""},
+		{strings.Replace(trace, "19\t97", "20\t97", 1), "traces differ at symbol 2 (offset differ)"},
+		{strings.Replace(trace, "2\t11\t0000000000000003", "3\t110\t0000000000000004", 1), "traces differ at symbol 2 (code, hash differ)"},
+		{strings.Replace(trace, "false", "true", 1), "traces differ at symbol 2 (new differ)"},
+		{trace[:strings.LastIndex(trace[:len(trace)-1], "\n")+1], "second trace ends before symbol 2"},
+		{trace + "3\t21\t98\tfalse\t2\t10\t0000000000000004\t'b'\n", "first trace ends before symbol 3"},
+	} {
+		d, err := diffTraces(strings.NewReader(trace), strings.NewReader(tt.other))
+		if err != nil || !strings.HasPrefix(d, tt.want) || (tt.want == "") != (d == "") {
+			t.Errorf("diff with %q = %q, %v, want %q", tt.other, d, err, tt.want)
+		}
+	}
+	if _, err := diffTraces(strings.NewReader(trace), strings.NewReader("0\t0\tx")); err == nil {
+		t.Error("invalid trace compared without error")
+	}
+}
+
+func TestTrain(t *testing.T) {
+	discardStdout(t)
+	dir := t.TempDir()
+	samples := [][]byte{
+		[]byte("GET /index.html HTTP/1.1\r\nHost: example.com\r\n\r\n"),
+		[]byte("GET /style.css HTTP/1.1\r\nHost: example.com\r\n\r\n"),
+	}
+	var names []string
+	for i, sample := range samples {
+		name := filepath.Join(dir, fmt.Sprintf("sample%d", i))
+		if err := os.WriteFile(name, sample, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	text := []byte("GET /script.js HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	name := filepath.Join(dir, "text")
+
+	for _, tt := range []struct {
+		args []string
+		want *huffman.Dictionary
+	}{
+		{nil, huffman.Train(samples)},
+		{[]string{"-contexts"}, huffman.TrainContexts(samples)},
+	} {
+		dictName := filepath.Join(dir, "dict")
+		if err := runTrain(append(append(tt.args, "-o", dictName), names...)); err != nil {
+			t.Fatal(err)
+		}
+		dict, err := loadDictionary(dictName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dict.ID() != tt.want.ID() || dict.HasContexts() != tt.want.HasContexts() {
+			t.Errorf("train %v: dictionary %08x, want %08x", tt.args, dict.ID(), tt.want.ID())
+		}
+
+		if err := os.WriteFile(name, text, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := runCompress([]string{"-dict", dictName, name}); err != nil {
+			t.Fatal(err)
+		}
+		if err := runDecompress([]string{name + defaultSuffix}); err == nil {
+			t.Errorf("train %v: decompressed without the dictionary", tt.args)
+		}
+		if err := runDecompress([]string{"-dict", dictName, name + defaultSuffix}); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, name); got != string(text) {
+			t.Errorf("train %v: decompressed %q", tt.args, got)
+		}
+	}
+}
@@ -29,7 +29,7 @@ func Init(h Interface) {
 	length := h.Len() // 6
 	//    last non-leaf node
 	//             ↓
-	for i := length/2 - 1; i > 0; i-- {
+	for i := length/2 - 1; i >= 0; i-- {
 		//      2    6
 		down(h, i, length)
 	}
@@ -0,0 +1,74 @@
+package heap
+
+import (
+	"slices"
+	"testing"
+)
+
+type intHeap []int
+
+func (h intHeap) Len() int           { return len(h) }
+func (h intHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h intHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *intHeap) Push(x any)        { *h = append(*h, x.(int)) }
+func (h *intHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// verify fails unless every parent in h is at most its children.
+func verify(t *testing.T, h intHeap) {
+	t.Helper()
+	for i := 1; i < len(h); i++ {
+		if parent := (i - 1) / 2; h[i] < h[parent] {
+			t.Fatalf("%v: h[%d] = %d is less than its parent h[%d] = %d", h, i, h[i], parent, h[parent])
+		}
+	}
+}
+
+func TestInit(t *testing.T) {
+	tests := [][]int{
+		{},
+		{1},
+		// only the root is out of order
+		{2, 1},
+		{5, 1, 2},
+		{9, 2, 3, 4, 5, 6, 7},
+		{5, 2, 4, 3, 8, 1},
+		{1, 2, 3, 4, 5},
+		{5, 4, 3, 2, 1},
+		{3, 3, 1, 1, 2, 2},
+	}
+	for _, tt := range tests {
+		h := intHeap(slices.Clone(tt))
+		Init(&h)
+		verify(t, h)
+
+		var popped []int
+		for h.Len() > 0 {
+			popped = append(popped, Pop(&h).(int))
+		}
+		want := slices.Clone(tt)
+		slices.Sort(want)
+		if !slices.Equal(popped, want) {
+			t.Errorf("Init(%v) then Pop = %v, want %v", tt, popped, want)
+		}
+	}
+}
+
+func TestPush(t *testing.T) {
+	h := new(intHeap)
+	for _, x := range []int{5, 7, 1, 8, 2, 2, 9, 0} {
+		Push(h, x)
+		verify(t, *h)
+	}
+	var popped []int
+	for h.Len() > 0 {
+		popped = append(popped, Pop(h).(int))
+	}
+	if want := []int{0, 1, 2, 2, 5, 7, 8, 9}; !slices.Equal(popped, want) {
+		t.Errorf("Pop = %v, want %v", popped, want)
+	}
+}
@@ -0,0 +1,232 @@
+// Huffgen generates Go source embedding files compressed with a static Huffman codebook,
+// to be used with go:generate:
+//
+//	//go:generate go run huffman_coding/huffgen -pkg assets -o assets.go static/
+//
+// All files are compressed with one canonical codebook built from their byte frequencies together.
+// The generated file holds the serialized codebook, the compressed files,
+// and accessor functions decompressing every file on first use:
+//
+//	func Asset(name string) ([]byte, error)
+//	func MustAsset(name string) []byte
+//	func AssetNames() []string
+//
+// Directories are walked, file names are slash separated paths as given,
+// without the prefix set by -strip.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"huffman_coding/huffman"
+)
+
+func main() {
+	pkg := flag.String("pkg", "main", "package name of the generated file")
+	out := flag.String("o", "assets.go", "write the generated source to `file`")
+	strip := flag.String("strip", "", "remove `prefix` from the file names")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: huffgen [-pkg name] [-o file] [-strip prefix] files...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*pkg, *out, *strip, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "huffgen:", err)
+		os.Exit(1)
+	}
+}
+
+// asset is a file to embed.
+type asset struct {
+	name string
+	data []byte
+}
+
+func run(pkg, out, strip string, roots []string) error {
+	assets, err := readAssets(roots, strip)
+	if err != nil {
+		return err
+	}
+
+	freqs := make(map[rune]uint64)
+	for _, a := range assets {
+		for _, b := range a.data {
+			freqs[rune(b)]++
+		}
+	}
+	cb, err := huffman.NewCodebook(freqs)
+	if err != nil {
+		return err
+	}
+	table, err := cb.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, header, strings.Join(os.Args[1:], " "), pkg, quote(table))
+	total, compressed := 0, 0
+	for _, a := range assets {
+		var buf bytes.Buffer
+		w := huffman.NewWriterOptions(&buf, huffman.Options{Model: cb, Size: int64(len(a.data))})
+		if _, err := w.Write(a.data); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		fmt.Fprintf(&src, "\t%s: {data: %s},\n", quote([]byte(a.name)), quote(buf.Bytes()))
+		total += len(a.data)
+		compressed += buf.Len()
+	}
+	src.WriteString(footer)
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting generated source: %w", err)
+	}
+	if err := os.WriteFile(out, formatted, 0o666); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "huffgen: %d files, %d bytes compressed to %d plus a table of %d\n",
+		len(assets), total, compressed, len(table))
+	return nil
+}
+
+// readAssets reads the named files and the files in the named directories, sorted by name.
+func readAssets(roots []string, strip string) ([]asset, error) {
+	var assets []asset
+	seen := make(map[string]bool)
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return fmt.Errorf("%s: not a regular file", path)
+			}
+			name := strings.TrimPrefix(filepath.ToSlash(path), strip)
+			if seen[name] {
+				return fmt.Errorf("%s: more than one file named %q", path, name)
+			}
+			seen[name] = true
+			data, err := os.ReadFile(path)
+			assets = append(assets, asset{name, data})
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	slices.SortFunc(assets, func(a, b asset) int { return strings.Compare(a.name, b.name) })
+	return assets, nil
+}
+
+// quote returns data as a Go string literal.
+// Bytes which aren't printable ASCII are escaped as \x, keeping the source plain ASCII.
+func quote(data []byte) string {
+	var b strings.Builder
+	b.Grow(len(data)*2 + 2)
+	b.WriteByte('"')
+	for _, c := range data {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c >= ' ' && c <= '~':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+const header = `// Code generated by "huffgen %s"; DO NOT EDIT.
+
+package %s
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"sync"
+
+	"huffman_coding/huffman"
+)
+
+// codebook is the serialized static codebook all assets are compressed with.
+const codebook = %s
+
+var loadCodebook = sync.OnceValues(func() (*huffman.Codebook, error) {
+	cb := new(huffman.Codebook)
+	return cb, cb.UnmarshalBinary([]byte(codebook))
+})
+
+// asset is an embedded file, decompressed on first use.
+type asset struct {
+	data string
+	once sync.Once
+	content []byte
+	err error
+}
+
+var assets = map[string]*asset{
+`
+
+const footer = `}
+
+// Asset returns the content of the named file, decompressing it on first use.
+// The returned slice is shared by all callers and must not be modified.
+func Asset(name string) ([]byte, error) {
+	a, ok := assets[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	a.once.Do(func() {
+		cb, err := loadCodebook()
+		if err != nil {
+			a.err = err
+			return
+		}
+		r := huffman.NewReaderOptions(strings.NewReader(a.data), huffman.Options{Model: cb})
+		a.content, a.err = io.ReadAll(r)
+	})
+	return a.content, a.err
+}
+
+// MustAsset is like Asset but panics if the file can't be decompressed.
+func MustAsset(name string) []byte {
+	content, err := Asset(name)
+	if err != nil {
+		panic(fmt.Sprintf("asset %s: %v", name, err))
+	}
+	return content
+}
+
+// AssetNames returns the names of all embedded files, sorted.
+func AssetNames() []string {
+	names := make([]string, 0, len(assets))
+	for name := range assets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+`
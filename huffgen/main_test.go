@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testAssets are the files generated packages embed, by slash separated path.
+var testAssets = map[string]string{
+	"static/index.html":     "<html><body>hello, \"world\"</body></html>\n",
+	"static/css/site.css":   "body { color: #333; }\n",
+	"static/bin/blob":       "\x00\x01\x02\xff\xfe\\\n",
+	"static/empty.txt":      "",
+	"static/css/print.css":  "body { color: black; }\n",
+	"static/css/nested/a/b": "nested",
+}
+
+// checkProgram is run with the generated package, given the expected assets.
+// It fails if anything isn't as generated.
+const checkProgram = `package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+
+	"gentest/assets"
+)
+
+func main() {
+	want := map[string]string{
+%s	}
+	var names []string
+	for name := range want {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	if got := assets.AssetNames(); !slices.Equal(got, names) {
+		fail("AssetNames() = %%q, want %%q", got, names)
+	}
+	for name, content := range want {
+		got, err := assets.Asset(name)
+		if err != nil || string(got) != content {
+			fail("Asset(%%q) = %%q, %%v, want %%q", name, got, err, content)
+		}
+		if got := assets.MustAsset(name); string(got) != content {
+			fail("MustAsset(%%q) = %%q, want %%q", name, got, content)
+		}
+	}
+	if _, err := assets.Asset("missing"); !errors.Is(err, fs.ErrNotExist) {
+		fail("Asset of a missing file: %%v, want fs.ErrNotExist", err)
+	}
+	defer func() {
+		if recover() == nil {
+			fail("MustAsset of a missing file didn't panic")
+		}
+	}()
+	assets.MustAsset("missing")
+}
+
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+`
+
+// testModule writes a module using this one to a temporary directory, with testAssets in it,
+// and changes to it.
+func testModule(t *testing.T) {
+	t.Helper()
+	root, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	goMod := "module gentest\n\ngo 1.22.2\n\nrequire huffman_coding v0.0.0\n\nreplace huffman_coding => " + root + "\n"
+	files := map[string]string{"go.mod": goMod}
+	for name, content := range testAssets {
+		files[name] = content
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestGenerate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the generated package")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command:", err)
+	}
+	testModule(t)
+	if err := os.Mkdir("assets", 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := run("assets", filepath.Join("assets", "assets.go"), "static/", []string{"static"}); err != nil {
+		t.Fatal(err)
+	}
+	src, err := os.ReadFile(filepath.Join("assets", "assets.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(src), "// Code generated by \"huffgen") || !strings.Contains(string(src), "\npackage assets\n") {
+		t.Errorf("generated source starts with\n%s", src[:min(len(src), 200)])
+	}
+
+	// the names are stripped of the prefix
+	var want strings.Builder
+	for name, content := range testAssets {
+		want.WriteString("\t\t" + quote([]byte(strings.TrimPrefix(name, "static/"))) + ": " + quote([]byte(content)) + ",\n")
+	}
+	if err := os.Mkdir("check", 0o777); err != nil {
+		t.Fatal(err)
+	}
+	program := fmt.Sprintf(checkProgram, want.String())
+	if err := os.WriteFile(filepath.Join("check", "main.go"), []byte(program), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(goTool, "run", "./check")
+	cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=-mod=mod")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("go run ./check: %v\n%s", err, out)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	testModule(t)
+	if err := os.Symlink("index.html", filepath.Join("static", "link.html")); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name  string
+		roots []string
+		want  string
+	}{
+		{"duplicate", []string{"static/index.html", "static/index.html"}, `more than one file named "index.html"`},
+		{"duplicate in a directory", []string{"static/css", "static/css/site.css"}, `more than one file named "css/site.css"`},
+		{"symbolic link", []string{"static/link.html"}, "not a regular file"},
+		{"missing", []string{"static/missing"}, "no such file"},
+	} {
+		err := run("assets", "assets.go", "static/", tt.roots)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: %v, want an error containing %q", tt.name, err, tt.want)
+		}
+	}
+	if _, err := os.Stat("assets.go"); !os.IsNotExist(err) {
+		t.Errorf("source generated despite the errors: %v", err)
+	}
+}
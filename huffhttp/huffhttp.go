@@ -0,0 +1,184 @@
+// Package huffhttp compresses HTTP bodies with the huffman package.
+//
+// The coding is negotiated with the Encoding token:
+// clients ask for compressed responses by listing it in Accept-Encoding,
+// and compressed bodies are sent with it as their Content-Encoding.
+package huffhttp
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"huffman_coding/huffman"
+)
+
+// Encoding is the content coding token of huffman streams.
+const Encoding = "x-huff"
+
+// NewHandler returns a handler calling h with compressed request bodies decoded
+// and compressing the responses of clients accepting Encoding, using the default options.
+func NewHandler(h http.Handler) http.Handler {
+	return NewHandlerOptions(h, huffman.Options{})
+}
+
+// NewHandlerOptions returns a handler calling h with compressed request bodies decoded
+// and compressing the responses of clients accepting Encoding, configured by opts.
+// Requests and responses in other codings are passed through untouched.
+//
+// Calls to the Flush method of the response writer flush the compressed stream,
+// so streaming handlers work as they do without compression.
+func NewHandlerOptions(h http.Handler, opts huffman.Options) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isEncoded(r.Header) {
+			r.Body = &body{Reader: huffman.NewReaderOptions(r.Body, opts), Closer: r.Body}
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !accepts(r.Header) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		rw := &responseWriter{ResponseWriter: w, opts: opts}
+		defer rw.close()
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// isEncoded tells if the body of a message with header h is coded with Encoding.
+func isEncoded(h http.Header) bool {
+	return strings.EqualFold(strings.TrimSpace(h.Get("Content-Encoding")), Encoding)
+}
+
+// accepts tells if Encoding is listed in the Accept-Encoding of h with a non-zero quality.
+// Wildcards don't count, clients have to ask for the coding explicitly.
+func accepts(h http.Header) bool {
+	for _, value := range h.Values("Accept-Encoding") {
+		for _, item := range strings.Split(value, ",") {
+			coding, params, _ := strings.Cut(item, ";")
+			if !strings.EqualFold(strings.TrimSpace(coding), Encoding) {
+				continue
+			}
+			q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+			if !ok {
+				return true
+			}
+			quality, err := strconv.ParseFloat(q, 64)
+			return err == nil && quality > 0
+		}
+	}
+	return false
+}
+
+// responseWriter compresses the response body once the header has been written,
+// unless the status doesn't allow a body or the handler has picked a coding itself.
+type responseWriter struct {
+	http.ResponseWriter
+	opts huffman.Options
+	// nil until the header has been written, and for responses which aren't compressed
+	w           *huffman.Writer
+	wroteHeader bool
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if rw.wroteHeader || code < http.StatusOK {
+		// informational responses can be written any number of times,
+		// and the ResponseWriter reports superfluous calls
+		rw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	rw.wroteHeader = true
+	h := rw.Header()
+	if code != http.StatusNoContent && code != http.StatusNotModified && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", Encoding)
+		// the length is the one of the uncompressed body
+		h.Del("Content-Length")
+		rw.w = huffman.NewWriterOptions(rw.ResponseWriter, rw.opts)
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	if !rw.wroteHeader {
+		// the content type would be sniffed from the compressed data otherwise
+		if h := rw.Header(); h.Get("Content-Type") == "" && h.Get("Content-Encoding") == "" {
+			h.Set("Content-Type", http.DetectContentType(p))
+		}
+		rw.WriteHeader(http.StatusOK)
+	}
+	if rw.w == nil {
+		return rw.ResponseWriter.Write(p)
+	}
+	return rw.w.Write(p)
+}
+
+// Flush implements http.Flusher, sending everything written so far to the client.
+func (rw *responseWriter) Flush() {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if rw.w != nil && rw.w.Flush() != nil {
+		// the client is gone, the handler finds out by its next write
+		return
+	}
+	http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// close ends the compressed stream after the handler has returned.
+func (rw *responseWriter) close() {
+	if rw.w != nil {
+		rw.w.Close()
+	}
+}
+
+// Transport is an http.RoundTripper asking for compressed responses
+// and transparently decoding them.
+// Requests setting Accept-Encoding themselves are left alone, as are their responses.
+type Transport struct {
+	// Base does the actual round trips, http.DefaultTransport if nil.
+	Base http.RoundTripper
+	// Options configures the Readers of responses.
+	Options huffman.Options
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Header.Get("Accept-Encoding") != "" {
+		return base.RoundTrip(req)
+	}
+
+	// a RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	req.Header.Set("Accept-Encoding", Encoding)
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if isEncoded(resp.Header) {
+		resp.Body = &body{Reader: huffman.NewReaderOptions(resp.Body, t.Options), Closer: resp.Body}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	return resp, nil
+}
+
+// body is a decoded message body, closing the original one.
+type body struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,237 @@
+package huffhttp
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"huffman_coding/huffman"
+)
+
+const text = "abracadabra, abracadabra! the quick brown fox jumps over the lazy dog"
+
+// plainClient neither asks for nor decodes any coding by itself.
+var plainClient = &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+func get(t *testing.T, url, acceptEncoding string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	resp, err := plainClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestNegotiation(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, text)
+	})))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		acceptEncoding string
+		compressed     bool
+	}{
+		{"", false},
+		{"x-huff", true},
+		{"X-Huff", true},
+		{"gzip, x-huff;q=0.5", true},
+		{"gzip, x-huff; q=1.0", true},
+		{"x-huff;q=0", false},
+		{"x-huff;q=0.000", false},
+		{"gzip, deflate", false},
+		{"*", false},
+	} {
+		resp := get(t, srv.URL, tt.acceptEncoding)
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.Header.Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("%q: Vary = %q", tt.acceptEncoding, got)
+		}
+		if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+			t.Errorf("%q: Content-Type = %q, want it sniffed from the uncompressed body", tt.acceptEncoding, got)
+		}
+		encoding := resp.Header.Get("Content-Encoding")
+		if !tt.compressed {
+			if encoding != "" || string(data) != text {
+				t.Errorf("%q: got Content-Encoding %q and body %q, want no coding", tt.acceptEncoding, encoding, data)
+			}
+			continue
+		}
+		if encoding != Encoding {
+			t.Errorf("%q: Content-Encoding = %q, want %q", tt.acceptEncoding, encoding, Encoding)
+			continue
+		}
+		decoded, err := io.ReadAll(huffman.NewReader(bytes.NewReader(data)))
+		if err != nil || string(decoded) != text {
+			t.Errorf("%q: decoded body %q, %v", tt.acceptEncoding, decoded, err)
+		}
+	}
+}
+
+func TestRequestBody(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "" || r.ContentLength != -1 {
+			http.Error(w, "coding or length of the compressed body left", http.StatusBadRequest)
+			return
+		}
+		io.Copy(w, r.Body)
+	})))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	w := huffman.NewWriter(&buf)
+	io.WriteString(w, text)
+	w.Close()
+	req, err := http.NewRequest(http.MethodPost, srv.URL, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Encoding", Encoding)
+	resp, err := plainClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK || string(data) != text {
+		t.Errorf("got %s %q, %v, want the decoded body echoed", resp.Status, data, err)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	read := make(chan struct{})
+	srv := httptest.NewServer(NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "first")
+		w.(http.Flusher).Flush()
+		// the client has to get the first chunk before the handler returns
+		<-read
+		io.WriteString(w, "second")
+	})))
+	defer srv.Close()
+	defer close(read)
+
+	client := &http.Client{Transport: &Transport{}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	first := make([]byte, len("first"))
+	if _, err := io.ReadFull(resp.Body, first); err != nil || string(first) != "first" {
+		t.Fatalf("first chunk %q, %v", first, err)
+	}
+	read <- struct{}{}
+	rest, err := io.ReadAll(resp.Body)
+	if err != nil || string(rest) != "second" {
+		t.Errorf("second chunk %q, %v", rest, err)
+	}
+}
+
+func TestNoBody(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/204":
+			w.WriteHeader(http.StatusNoContent)
+		case "/304":
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			io.WriteString(w, text)
+		}
+	})))
+	defer srv.Close()
+
+	for _, path := range []string{"/204", "/304"} {
+		resp := get(t, srv.URL+path, Encoding)
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || len(data) != 0 {
+			t.Errorf("%s: body %q, %v, want none", path, data, err)
+		}
+		if got := resp.Header.Get("Content-Encoding"); got != "" {
+			t.Errorf("%s: Content-Encoding = %q, want none", path, got)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodHead, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", Encoding)
+	resp, err := plainClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK || len(data) != 0 {
+		t.Errorf("HEAD: %s with body %q, %v, want 200 without a body", resp.Status, data, err)
+	}
+	// HEAD gets the header GET would get
+	if got := resp.Header.Get("Content-Encoding"); got != Encoding {
+		t.Errorf("HEAD: Content-Encoding = %q, want %q", got, Encoding)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	srv := httptest.NewServer(NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Accept-Encoding", r.Header.Get("Accept-Encoding"))
+		io.WriteString(w, text)
+	})))
+	defer srv.Close()
+	client := &http.Client{Transport: &Transport{}}
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(data) != text {
+		t.Errorf("body %q, %v", data, err)
+	}
+	if got := resp.Header.Get("X-Accept-Encoding"); got != Encoding {
+		t.Errorf("server got Accept-Encoding %q, want %q", got, Encoding)
+	}
+	if !resp.Uncompressed || resp.Header.Get("Content-Encoding") != "" {
+		t.Errorf("response not marked as decoded")
+	}
+
+	// Accept-Encoding set by the caller is sent as is, and the response isn't decoded
+	for _, acceptEncoding := range []string{"identity", Encoding} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.Header.Get("X-Accept-Encoding"); got != acceptEncoding {
+			t.Errorf("server got Accept-Encoding %q, want %q", got, acceptEncoding)
+		}
+		compressed := acceptEncoding == Encoding
+		if resp.Uncompressed || (resp.Header.Get("Content-Encoding") == Encoding) != compressed || (string(data) == text) == compressed {
+			t.Errorf("%q: response with Content-Encoding %q changed by the Transport", acceptEncoding, resp.Header.Get("Content-Encoding"))
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package huffman
+
+import (
+	"errors"
+	"fmt"
+	"huffman_coding/bits"
+	"huffman_coding/heap"
+	"math"
+	"sort"
+)
+
+// MaxCodeLength is the longest code a Codebook assigns.
+// Frequencies which would give longer codes are flattened until they don't.
+const MaxCodeLength = 32
+
+var (
+	errEmptyCodebook = errors.New("huffman: codebook has no symbols")
+	// ErrUnknownSymbol is returned when coding a symbol the codebook has no code for.
+	ErrUnknownSymbol = errors.New("huffman: symbol not in codebook")
+	// ErrInvalidCode is returned when decoding bits which aren't the code of any symbol.
+	ErrInvalidCode = errors.New("huffman: invalid code")
+)
+
+// Codebook is a static canonical Huffman code.
+//
+// Codes are canonical: symbols sorted by code length and then by value get consecutive codes,
+// so the code lengths alone define the codebook.
+//
+// A Codebook implements Model, never updating itself.
+// To be used as a model of a Writer it must have codes for Escape and End,
+// which are included by NewCodebook and NewCodebookProbabilities if they're missing.
+type Codebook struct {
+	// symbols in canonical order
+	symbols []CodeEntry
+	codes   map[rune]CodeEntry
+	// per code length: the first code, the number of codes and the index of the first symbol
+	first, count, offset [MaxCodeLength + 1]int
+}
+
+// CodeEntry is the code of a single symbol.
+type CodeEntry struct {
+	Char   rune
+	Code   uint64
+	Length uint8
+}
+
+// NewCodebook builds the Huffman codebook of the given symbol frequencies.
+// Symbols with zero frequency get no code.
+// Escape and End are added with frequency 1 if they're missing.
+func NewCodebook(freqs map[rune]uint64) (*Codebook, error) {
+	chars := make([]rune, 0, len(freqs)+customChars)
+	for char, f := range freqs {
+		if f > 0 {
+			chars = append(chars, char)
+		}
+	}
+	for _, char := range []rune{Escape, End} {
+		if freqs[char] == 0 {
+			chars = append(chars, char)
+		}
+	}
+	sort.Slice(chars, func(i, j int) bool { return chars[i] < chars[j] })
+
+	// Node.Freq is an int, so very large frequencies are scaled down first
+	counts := make([]uint64, len(chars))
+	var total uint64
+	for i, char := range chars {
+		counts[i] = max(freqs[char], 1)
+		total += counts[i]
+		if total < counts[i] || total > 1<<53 {
+			return newCodebookScaled(chars, counts, freqs)
+		}
+	}
+	return newCodebookCounts(chars, counts, MaxCodeLength)
+}
+
+// newCodebookScaled builds the codebook of frequencies too large to be added up.
+func newCodebookScaled(chars []rune, counts []uint64, freqs map[rune]uint64) (*Codebook, error) {
+	var largest uint64
+	for _, char := range chars {
+		largest = max(largest, freqs[char])
+	}
+	shift := 0
+	for (largest >> shift) > 1<<53/uint64(len(chars)) {
+		shift++
+	}
+	for i, char := range chars {
+		counts[i] = max(freqs[char]>>shift, 1)
+	}
+	return newCodebookCounts(chars, counts, MaxCodeLength)
+}
+
+// NewCodebookProbabilities builds the Huffman codebook of the given symbol probabilities.
+// Probabilities don't have to add up to 1, they're normalized.
+// Symbols with zero probability get no code.
+// Escape and End are added with the lowest possible probability if they're missing.
+func NewCodebookProbabilities(probs map[rune]float64) (*Codebook, error) {
+	sum := 0.0
+	for char, p := range probs {
+		if p < 0 || math.IsNaN(p) || math.IsInf(p, 0) {
+			return nil, fmt.Errorf("huffman: invalid probability %v of %s", p, symbolName(char))
+		}
+		sum += p
+	}
+	if sum == 0 || math.IsInf(sum, 0) {
+		return nil, errEmptyCodebook
+	}
+	freqs := make(map[rune]uint64, len(probs))
+	for char, p := range probs {
+		if p > 0 {
+			freqs[char] = max(uint64(p/sum*(1<<32)), 1)
+		}
+	}
+	return NewCodebook(freqs)
+}
+
+// NewCodebookLengths builds the canonical codebook with the given code lengths,
+// as exported by Codebook.Lengths.
+// The lengths must satisfy the Kraft inequality, the sum of 2^-length over all symbols
+// must not be greater than 1, or the codes couldn't be told apart.
+func NewCodebookLengths(lengths map[rune]uint8) (*Codebook, error) {
+	if len(lengths) == 0 {
+		return nil, errEmptyCodebook
+	}
+	// Kraft sum in units of 2^-MaxCodeLength
+	var kraft uint64
+	for char, length := range lengths {
+		if length == 0 || length > MaxCodeLength {
+			return nil, fmt.Errorf("huffman: invalid code length %d of %s", length, symbolName(char))
+		}
+		kraft += 1 << (MaxCodeLength - length)
+	}
+	if kraft > 1<<MaxCodeLength {
+		return nil, fmt.Errorf("huffman: code lengths violate the Kraft inequality (sum %g > 1)",
+			float64(kraft)/(1<<MaxCodeLength))
+	}
+	return newCanonicalCodebook(lengths), nil
+}
+
+// newCodebookCounts builds the Huffman tree of chars with the given counts using the same
+// heap and tie-breaking as the adaptive model, and turns its code lengths into a canonical codebook.
+// No code gets longer than maxLength, which must leave room for all chars.
+// chars must be sorted.
+func newCodebookCounts(chars []rune, counts []uint64, maxLength uint8) (*Codebook, error) {
+	if len(chars) == 0 {
+		return nil, errEmptyCodebook
+	}
+	for {
+		lengths := huffmanLengths(chars, counts)
+		longest := uint8(0)
+		for _, length := range lengths {
+			longest = max(longest, length)
+		}
+		if longest <= maxLength {
+			return newCanonicalCodebook(lengths), nil
+		}
+		// flatten the distribution until the tree is shallow enough
+		for i := range counts {
+			counts[i] = counts[i]/2 + 1
+		}
+	}
+}
+
+// huffmanLengths returns the code lengths of the Huffman tree of chars with the given counts.
+// A single symbol gets length 1.
+func huffmanLengths(chars []rune, counts []uint64) map[rune]uint8 {
+	h := make(NodeHeap, len(chars))
+	leaves := make([]*Node, len(chars))
+	for i, char := range chars {
+		leaves[i] = &Node{Freq: int(counts[i]), Char: char, order: i, index: i}
+		h[i] = leaves[i]
+	}
+	heap.Init(&h)
+	order := len(chars)
+	for h.Len() > 1 {
+		left := heap.Pop(&h).(*Node)
+		right := heap.Pop(&h).(*Node)
+		parent := &Node{Freq: left.Freq + right.Freq, order: order, Left: left, Right: right}
+		order++
+		left.Parent = parent
+		right.Parent = parent
+		heap.Push(&h, parent)
+	}
+
+	lengths := make(map[rune]uint8, len(leaves))
+	for _, leaf := range leaves {
+		_, length := leaf.Code()
+		lengths[leaf.Char] = max(length, 1)
+	}
+	return lengths
+}
+
+// newCanonicalCodebook assigns canonical codes to symbols with the given valid lengths.
+func newCanonicalCodebook(lengths map[rune]uint8) *Codebook {
+	c := &Codebook{
+		symbols: make([]CodeEntry, 0, len(lengths)),
+		codes:   make(map[rune]CodeEntry, len(lengths)),
+	}
+	for char, length := range lengths {
+		c.symbols = append(c.symbols, CodeEntry{Char: char, Length: length})
+	}
+	sort.Slice(c.symbols, func(i, j int) bool {
+		a, b := c.symbols[i], c.symbols[j]
+		if a.Length != b.Length {
+			return a.Length < b.Length
+		}
+		return a.Char < b.Char
+	})
+
+	code := uint64(0)
+	prev := c.symbols[0].Length
+	for i := range c.symbols {
+		e := &c.symbols[i]
+		// every longer code starts where the shorter ones ended, extended with zeros
+		code <<= e.Length - prev
+		prev = e.Length
+		if c.count[e.Length] == 0 {
+			c.first[e.Length] = int(code)
+			c.offset[e.Length] = i
+		}
+		c.count[e.Length]++
+		e.Code = code
+		c.codes[e.Char] = *e
+		code++
+	}
+	return c
+}
+
+// Codes returns the codes of all symbols in canonical order.
+func (c *Codebook) Codes() []CodeEntry {
+	return append([]CodeEntry(nil), c.symbols...)
+}
+
+// Lengths returns the code length of every symbol.
+// The codebook can be rebuilt from them with NewCodebookLengths.
+func (c *Codebook) Lengths() map[rune]uint8 {
+	lengths := make(map[rune]uint8, len(c.symbols))
+	for _, e := range c.symbols {
+		lengths[e.Char] = e.Length
+	}
+	return lengths
+}
+
+// Code implements Model.
+func (c *Codebook) Code(char rune) (code uint64, length uint8, ok bool) {
+	e, ok := c.codes[char]
+	return e.Code, e.Length, ok
+}
+
+// Decode implements Model.
+// Canonical codes of the same length are consecutive,
+// so a code is recognized as soon as it falls into the range of its length.
+func (c *Codebook) Decode(br *bits.Reader) (char rune, err error) {
+	code := 0
+	for length := 1; length <= MaxCodeLength; length++ {
+		bit, err := br.ReadOneBit()
+		if err != nil {
+			return 0, err
+		}
+		code <<= 1
+		if bit {
+			code |= 1
+		}
+		if i := code - c.first[length]; c.count[length] > 0 && i >= 0 && i < c.count[length] {
+			return c.symbols[c.offset[length]+i].Char, nil
+		}
+	}
+	return 0, ErrInvalidCode
+}
+
+// Update implements Model. Codebooks are static, so it does nothing.
+func (c *Codebook) Update(char rune) {}
+
+// Encoder writes symbols coded with a Codebook to a bits.Writer.
+type Encoder struct {
+	c  *Codebook
+	bw *bits.Writer
+}
+
+// NewEncoder returns an Encoder writing codes of c to bw.
+func (c *Codebook) NewEncoder(bw *bits.Writer) *Encoder {
+	return &Encoder{c: c, bw: bw}
+}
+
+// Encode writes the code of char.
+func (e *Encoder) Encode(char rune) error {
+	code, length, ok := e.c.Code(char)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownSymbol, symbolName(char))
+	}
+	return e.bw.WriteBits(code, length)
+}
+
+// Decoder reads symbols coded with a Codebook from a bits.Reader.
+type Decoder struct {
+	c  *Codebook
+	br *bits.Reader
+}
+
+// NewDecoder returns a Decoder reading codes of c from br.
+func (c *Codebook) NewDecoder(br *bits.Reader) *Decoder {
+	return &Decoder{c: c, br: br}
+}
+
+// Decode reads the next symbol.
+func (d *Decoder) Decode() (rune, error) {
+	return d.c.Decode(d.br)
+}
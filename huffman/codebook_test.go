@@ -0,0 +1,256 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+
+	"huffman_coding/bits"
+)
+
+// codeStrings returns the codes of c as strings of bits, by symbol.
+func codeStrings(c *Codebook) map[rune]string {
+	codes := make(map[rune]string)
+	for _, e := range c.Codes() {
+		codes[e.Char] = formatCode(e.Code, e.Length)
+	}
+	return codes
+}
+
+func equalCodes(got, want map[rune]string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for char, code := range want {
+		if got[char] != code {
+			return false
+		}
+	}
+	return true
+}
+
+// kraftSum returns the sum of 2^-length over the codes of c.
+func kraftSum(c *Codebook) float64 {
+	sum := 0.0
+	for _, e := range c.Codes() {
+		sum += math.Ldexp(1, -int(e.Length))
+	}
+	return sum
+}
+
+func TestNewCodebook(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		freqs map[rune]uint64
+		want  map[rune]string
+	}{
+		{
+			"skewed",
+			map[rune]uint64{'a': 5, 'b': 2, 'c': 1, 'd': 1},
+			map[rune]string{'a': "0", 'b': "100", End: "101", Escape: "110", 'c': "1110", 'd': "1111"},
+		},
+		{
+			"single",
+			map[rune]uint64{'a': 1},
+			map[rune]string{Escape: "0", 'a': "10", End: "11"},
+		},
+		{
+			// zero frequencies get no code, given Escape and End keep theirs
+			"zeros",
+			map[rune]uint64{'a': 3, 'b': 0, Escape: 2, End: 1},
+			map[rune]string{'a': "0", End: "10", Escape: "11"},
+		},
+		{
+			"uniform",
+			map[rune]uint64{'a': 1, 'b': 1, Escape: 1, End: 1},
+			map[rune]string{'a': "00", 'b': "01", End: "10", Escape: "11"},
+		},
+		{
+			// too large to be added up, they're scaled down
+			"huge",
+			map[rune]uint64{'a': math.MaxUint64, 'b': math.MaxUint64 / 2, 'c': math.MaxUint64 / 4, Escape: 1, End: 1},
+			map[rune]string{'a': "0", 'b': "10", 'c': "110", End: "1110", Escape: "1111"},
+		},
+	} {
+		c, err := NewCodebook(tt.freqs)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := codeStrings(c); !equalCodes(got, tt.want) {
+			t.Errorf("%s: codes %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewCodebookLengths(t *testing.T) {
+	for _, tt := range []struct {
+		lengths map[rune]uint8
+		want    map[rune]string
+	}{
+		{
+			map[rune]uint8{'a': 1, 'b': 2, 'c': 3, 'd': 3},
+			map[rune]string{'a': "0", 'b': "10", 'c': "110", 'd': "111"},
+		},
+		{
+			// codes of the same length are ordered by symbol, not by the order they're given in
+			map[rune]uint8{'d': 2, 'c': 2, 'b': 2, 'a': 2},
+			map[rune]string{'a': "00", 'b': "01", 'c': "10", 'd': "11"},
+		},
+		{
+			// incomplete codes are allowed
+			map[rune]uint8{'z': 1, 'a': 3},
+			map[rune]string{'z': "0", 'a': "100"},
+		},
+		{
+			map[rune]uint8{'x': MaxCodeLength},
+			map[rune]string{'x': formatCode(0, MaxCodeLength)},
+		},
+	} {
+		c, err := NewCodebookLengths(tt.lengths)
+		if err != nil {
+			t.Errorf("%v: %v", tt.lengths, err)
+			continue
+		}
+		if got := codeStrings(c); !equalCodes(got, tt.want) {
+			t.Errorf("%v: codes %q, want %q", tt.lengths, got, tt.want)
+		}
+		for char, length := range c.Lengths() {
+			if length != tt.lengths[char] {
+				t.Errorf("%v: Lengths()[%s] = %d", tt.lengths, symbolName(char), length)
+			}
+		}
+	}
+}
+
+func TestNewCodebookInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		new  func() (*Codebook, error)
+	}{
+		{"no lengths", func() (*Codebook, error) { return NewCodebookLengths(nil) }},
+		{"zero length", func() (*Codebook, error) { return NewCodebookLengths(map[rune]uint8{'a': 0, 'b': 1}) }},
+		{"too long", func() (*Codebook, error) { return NewCodebookLengths(map[rune]uint8{'a': MaxCodeLength + 1}) }},
+		{"kraft", func() (*Codebook, error) { return NewCodebookLengths(map[rune]uint8{'a': 1, 'b': 1, 'c': 1}) }},
+		{"kraft long", func() (*Codebook, error) {
+			return NewCodebookLengths(map[rune]uint8{'a': 1, 'b': 2, 'c': 3, 'd': 3, 'e': MaxCodeLength})
+		}},
+		{"no probabilities", func() (*Codebook, error) { return NewCodebookProbabilities(nil) }},
+		{"zero probabilities", func() (*Codebook, error) { return NewCodebookProbabilities(map[rune]float64{'a': 0}) }},
+		{"negative", func() (*Codebook, error) { return NewCodebookProbabilities(map[rune]float64{'a': 1, 'b': -0.5}) }},
+		{"NaN", func() (*Codebook, error) { return NewCodebookProbabilities(map[rune]float64{'a': math.NaN()}) }},
+		{"infinite", func() (*Codebook, error) { return NewCodebookProbabilities(map[rune]float64{'a': math.Inf(1)}) }},
+		{"infinite sum", func() (*Codebook, error) {
+			return NewCodebookProbabilities(map[rune]float64{'a': math.MaxFloat64, 'b': math.MaxFloat64})
+		}},
+	} {
+		if c, err := tt.new(); err == nil {
+			t.Errorf("%s: got codes %q, want an error", tt.name, codeStrings(c))
+		}
+	}
+}
+
+func TestNewCodebookProbabilities(t *testing.T) {
+	c, err := NewCodebookProbabilities(map[rune]float64{'a': 0.5, 'b': 0.25, 'c': 0.125, 'd': 0.125, 'e': 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Escape and End get the lowest probability, below everything else,
+	// and ties are broken the way the adaptive model breaks them
+	want := map[rune]string{'a': "0", 'b': "10", 'd': "110", 'c': "1110", End: "11110", Escape: "11111"}
+	if got := codeStrings(c); !equalCodes(got, want) {
+		t.Errorf("codes %q, want %q", got, want)
+	}
+
+	// only the proportions count
+	scaled, err := NewCodebookProbabilities(map[rune]float64{'a': 4, 'b': 2, 'c': 1, 'd': 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := codeStrings(scaled); !equalCodes(got, want) {
+		t.Errorf("scaled: codes %q, want %q", got, want)
+	}
+}
+
+func TestCodebookMaxLength(t *testing.T) {
+	// Fibonacci frequencies make the deepest Huffman trees, one level per symbol
+	freqs := make(map[rune]uint64)
+	a, b := uint64(1), uint64(1)
+	for char := 'A'; char < 'A'+60; char++ {
+		freqs[char] = a
+		a, b = b, a+b
+	}
+	c, err := NewCodebook(freqs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shortest, longest := uint8(MaxCodeLength), uint8(0)
+	for _, e := range c.Codes() {
+		shortest = min(shortest, e.Length)
+		longest = max(longest, e.Length)
+	}
+	if longest > MaxCodeLength {
+		t.Errorf("longest code %d bits, want it flattened to at most %d", longest, MaxCodeLength)
+	}
+	if sum := kraftSum(c); sum > 1 {
+		t.Errorf("Kraft sum %g > 1", sum)
+	}
+	// the most frequent symbol still gets the shortest code
+	if _, length, _ := c.Code('A' + 59); length != shortest {
+		t.Errorf("most frequent symbol has a code of %d bits, the shortest has %d", length, shortest)
+	}
+	testEncodeDecode(t, c, []rune("ABCDEFGHIJKLMNOPQRSTUVWXYZ[]|"))
+}
+
+// testEncodeDecode checks that chars come back unchanged through an Encoder and a Decoder of c.
+func testEncodeDecode(t *testing.T, c *Codebook, chars []rune) {
+	t.Helper()
+	var buf bytes.Buffer
+	bw := bits.NewWriter(&buf)
+	enc := c.NewEncoder(bw)
+	for _, char := range chars {
+		if err := enc.Encode(char); err != nil {
+			t.Fatalf("Encode(%s): %v", symbolName(char), err)
+		}
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dec := c.NewDecoder(bits.NewReader(&buf))
+	for i, want := range chars {
+		got, err := dec.Decode()
+		if err != nil || got != want {
+			t.Fatalf("symbol %d: Decode = %s, %v, want %s", i, symbolName(got), err, symbolName(want))
+		}
+	}
+}
+
+func TestCodebookEncodeDecode(t *testing.T) {
+	text := []rune("abracadabra, abracadabra!")
+	freqs := make(map[rune]uint64)
+	for _, char := range text {
+		freqs[char]++
+	}
+	c, err := NewCodebook(freqs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEncodeDecode(t, c, append(text, Escape, End))
+
+	if err := c.NewEncoder(bits.NewWriter(&bytes.Buffer{})).Encode('z'); !errors.Is(err, ErrUnknownSymbol) {
+		t.Errorf("Encode of a symbol without code: %v, want ErrUnknownSymbol", err)
+	}
+}
+
+func TestCodebookInvalidCode(t *testing.T) {
+	// 11 is the code of nothing
+	c, err := NewCodebookLengths(map[rune]uint8{'a': 1, 'b': 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := c.NewDecoder(bits.NewReader(bytes.NewReader(bytes.Repeat([]byte{0xff}, MaxCodeLength/8))))
+	if char, err := dec.Decode(); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("Decode = %s, %v, want ErrInvalidCode", symbolName(char), err)
+	}
+}
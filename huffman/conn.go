@@ -0,0 +1,133 @@
+package huffman
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// Conn is a net.Conn compressing everything written to it and decompressing everything read from it.
+// Each direction is a single stream, so the adaptive model keeps learning
+// over all the messages of the connection instead of starting over for every one of them.
+//
+// Both ends of the connection have to be wrapped, with equivalent options.
+// Like any net.Conn it may be used by multiple goroutines at the same time.
+type Conn struct {
+	net.Conn
+
+	// wmu guards the writing side
+	wmu          sync.Mutex
+	w            *Writer
+	flushOnWrite bool
+	closed       bool
+
+	// rmu guards the reading side
+	rmu sync.Mutex
+	r   *Reader
+}
+
+// NewConn returns a Conn wrapping c with the default options, flushing on every write.
+func NewConn(c net.Conn) *Conn {
+	return NewConnOptions(c, Options{})
+}
+
+// NewConnOptions returns a Conn wrapping c, configured by opts, flushing on every write.
+func NewConnOptions(c net.Conn, opts Options) *Conn {
+	return &Conn{
+		Conn:         c,
+		w:            NewWriterOptions(c, opts),
+		r:            NewReaderOptions(c, opts),
+		flushOnWrite: true,
+	}
+}
+
+// SetFlushOnWrite sets whether every Write is flushed right away, which is the default.
+// Without it written data is buffered until Flush is called,
+// which saves the few bytes every flush costs when a message takes several writes.
+func (c *Conn) SetFlushOnWrite(flush bool) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.flushOnWrite = flush
+}
+
+// Read reads decompressed data.
+// It returns as soon as data flushed by the other end has been read,
+// without waiting for p to be filled.
+// Once a read has failed, including by a read deadline passing, every following one fails the same:
+// the stream can't be resumed in the middle of a code, the connection has to be closed.
+func (c *Conn) Read(p []byte) (n int, err error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	return c.r.Read(p)
+}
+
+// Write compresses p, flushing it to the connection unless flushing on write has been turned off.
+func (c *Conn) Write(p []byte) (n int, err error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	if n, err = c.w.Write(p); err != nil {
+		return n, err
+	}
+	if c.flushOnWrite {
+		err = c.w.Flush()
+	}
+	return n, err
+}
+
+// Flush sends everything written so far to the other end.
+func (c *Conn) Flush() error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	return c.w.Flush()
+}
+
+// CloseWrite ends the compressed stream, so that reads at the other end return io.EOF,
+// and shuts down the writing side of the connection if it supports that, like *net.TCPConn does.
+func (c *Conn) CloseWrite() error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := c.closeStream(); err != nil {
+		return err
+	}
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// Close ends the compressed stream and closes the connection.
+// If a write is in progress at the same time, which may be blocked for good,
+// the connection is closed first to make it fail, and Close waits for it to return.
+// The stream is then cut off where it is, and the other end fails to read the rest.
+// Ending the stream writes to the connection, so with synchronous connections
+// like the ones of net.Pipe the other end has to be reading.
+func (c *Conn) Close() error {
+	if !c.wmu.TryLock() {
+		err := c.Conn.Close()
+		c.wmu.Lock()
+		c.closed = true
+		c.wmu.Unlock()
+		return err
+	}
+	err := c.closeStream()
+	c.wmu.Unlock()
+	if closeErr := c.Conn.Close(); err == nil || errors.Is(err, net.ErrClosed) {
+		err = closeErr
+	}
+	return err
+}
+
+// closeStream ends the compressed stream once, c.wmu must be held.
+func (c *Conn) closeStream() error {
+	if c.closed {
+		return net.ErrClosed
+	}
+	c.closed = true
+	return c.w.Close()
+}
@@ -0,0 +1,226 @@
+package huffman
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// connPair returns two Conns wrapping the ends of a net.Pipe.
+func connPair(t *testing.T) (a, b *Conn) {
+	t.Helper()
+	ca, cb := net.Pipe()
+	a, b = NewConn(ca), NewConn(cb)
+	t.Cleanup(func() {
+		ca.Close()
+		cb.Close()
+	})
+	return a, b
+}
+
+// goWrite calls write in a new goroutine, net.Pipe blocks writes until they are read.
+func goWrite(write func() error) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- write() }()
+	return done
+}
+
+func TestConnMessages(t *testing.T) {
+	a, b := connPair(t)
+	messages := []string{"hello", "world", "hello world"}
+	done := goWrite(func() error {
+		for _, m := range messages {
+			if _, err := a.Write([]byte(m)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	buf := make([]byte, 100)
+	for _, want := range messages {
+		n, err := b.Read(buf)
+		if err != nil || string(buf[:n]) != want {
+			t.Fatalf("Read = %q, %v, want %q", buf[:n], err, want)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnFlush(t *testing.T) {
+	a, b := connPair(t)
+	a.SetFlushOnWrite(false)
+	// nothing is sent before Flush, else the writes would block with nobody reading
+	done := goWrite(func() error {
+		for _, m := range []string{"one ", "message ", "in parts"} {
+			if _, err := a.Write([]byte(m)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("writes without flushing block")
+	}
+
+	done = goWrite(a.Flush)
+	buf := make([]byte, 100)
+	n, err := b.Read(buf)
+	if err != nil || string(buf[:n]) != "one message in parts" {
+		t.Fatalf("Read = %q, %v, want the whole message", buf[:n], err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnCloseWrite(t *testing.T) {
+	a, b := connPair(t)
+	done := goWrite(func() error {
+		if _, err := a.Write([]byte("last words")); err != nil {
+			return err
+		}
+		return a.CloseWrite()
+	})
+	data, err := io.ReadAll(b)
+	if err != nil || string(data) != "last words" {
+		t.Errorf("ReadAll = %q, %v, want the data and io.EOF", data, err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Write([]byte("more")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Write after CloseWrite: %v, want net.ErrClosed", err)
+	}
+	if err := a.Flush(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Flush after CloseWrite: %v, want net.ErrClosed", err)
+	}
+
+	// the other direction is still open
+	done = goWrite(func() error {
+		_, err := b.Write([]byte("reply"))
+		return err
+	})
+	buf := make([]byte, 10)
+	if n, err := a.Read(buf); err != nil || string(buf[:n]) != "reply" {
+		t.Errorf("Read after CloseWrite = %q, %v", buf[:n], err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnDoubleClose(t *testing.T) {
+	a, b := connPair(t)
+	read := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(b)
+		read <- err
+	}()
+	if err := a.Close(); err != nil {
+		t.Fatalf("first Close: %v", err)
+	}
+	if err := <-read; err != nil {
+		t.Errorf("the other end read %v, want io.EOF", err)
+	}
+	// the second Close neither blocks nor writes anything
+	if err := a.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		t.Errorf("second Close: %v", err)
+	}
+	if _, err := a.Write([]byte("x")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Write after Close: %v, want net.ErrClosed", err)
+	}
+}
+
+func TestConnReadDeadline(t *testing.T) {
+	ca, cb := net.Pipe()
+	defer ca.Close()
+	defer cb.Close()
+	b := NewConn(cb)
+
+	data := compressed(t, Options{}, []byte("the message cut in the middle of a code"))
+	half := len(data) / 2
+	done := goWrite(func() error {
+		_, err := ca.Write(data[:half])
+		return err
+	})
+	if err := b.SetReadDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	_, err := io.ReadAll(b)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("read past the deadline: %v, want os.ErrDeadlineExceeded", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// the rest of the stream arrives in time, but the decoder can't resume
+	b.SetReadDeadline(time.Time{})
+	done = goWrite(func() error {
+		_, err := ca.Write(data[half:])
+		return err
+	})
+	if _, again := b.Read(make([]byte, 100)); !errors.Is(again, os.ErrDeadlineExceeded) {
+		t.Errorf("read after the deadline error: %v, want the same error", again)
+	}
+	ca.Close()
+	<-done
+}
+
+func TestConnCloseDuringWrite(t *testing.T) {
+	a, b := connPair(t)
+	done := goWrite(func() error {
+		_, err := a.Write([]byte("first"))
+		return err
+	})
+	buf := make([]byte, 100)
+	if n, err := b.Read(buf); err != nil || string(buf[:n]) != "first" {
+		t.Fatalf("Read = %q, %v", buf[:n], err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// nobody reads the second message, so its write blocks until Close unblocks it
+	written := make(chan struct{})
+	done = goWrite(func() error {
+		defer close(written)
+		_, err := a.Write([]byte("second"))
+		return err
+	})
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-written:
+		t.Fatal("write to a net.Pipe nobody reads returned")
+	default:
+	}
+	closed := goWrite(a.Close)
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Close: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked by the write")
+	}
+	if err := <-done; err == nil {
+		t.Error("write cut off by Close succeeded")
+	}
+	if _, err := a.Write([]byte("x")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Write after Close: %v, want net.ErrClosed", err)
+	}
+	// the stream has been cut off
+	if _, err := b.Read(buf); err != io.ErrUnexpectedEOF {
+		t.Errorf("Read of the cut off stream: %v, want io.ErrUnexpectedEOF", err)
+	}
+}
@@ -0,0 +1,58 @@
+package huffman
+
+import (
+	"context"
+	"io"
+)
+
+// chunkSize is the amount of data CompressContext and DecompressContext
+// process between checks of their context, and the buffer size of Writer.ReadFrom and Reader.WriteTo.
+const chunkSize = 64 << 10
+
+// CompressContext compresses everything read from src until io.EOF to dst,
+// with a Writer configured by opts.
+// ctx is checked before every chunk of input, when it's done the compression stops
+// and ctx.Err() is returned, leaving an incomplete stream in dst.
+// A Read of src blocking forever isn't interrupted, src has to be closed for that.
+func CompressContext(ctx context.Context, dst io.Writer, src io.Reader, opts Options) error {
+	w := NewWriterOptions(dst, opts)
+	if _, err := copyContext(ctx, w, src, w.chunk()); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// DecompressContext decompresses the stream read from src to dst,
+// with a Reader configured by opts.
+// ctx is checked before every chunk of output, when it's done the decompression stops
+// and ctx.Err() is returned.
+// A Read of src blocking forever isn't interrupted, src has to be closed for that.
+func DecompressContext(ctx context.Context, dst io.Writer, src io.Reader, opts Options) error {
+	r := NewReaderOptions(src, opts)
+	_, err := copyContext(ctx, dst, r, r.chunk())
+	return err
+}
+
+// copyContext copies src to dst in chunks of the size of buf, checking ctx before each of them.
+// Unlike io.Copy it never calls ReadFrom or WriteTo, so it implements them.
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader, buf []byte) (written int64, err error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		n, err := src.Read(buf)
+		if n > 0 {
+			m, err := dst.Write(buf[:n])
+			written += int64(m)
+			if err != nil {
+				return written, err
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
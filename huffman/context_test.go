@@ -0,0 +1,97 @@
+package huffman
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// slowReader reads r a little at a time, sleeping before every read.
+type slowReader struct {
+	r io.Reader
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	return s.r.Read(p[:min(len(p), 512)])
+}
+
+// endless repeats data forever.
+type endless struct {
+	data []byte
+	pos  int
+}
+
+func (e *endless) Read(p []byte) (int, error) {
+	n := copy(p, e.data[e.pos:])
+	e.pos = (e.pos + n) % len(e.data)
+	return n, nil
+}
+
+func TestContextCancel(t *testing.T) {
+	data := testData(256 << 10)
+	stream := compressed(t, Options{}, data)
+	tests := []struct {
+		name string
+		run  func(ctx context.Context) error
+	}{
+		{"compress", func(ctx context.Context) error {
+			return CompressContext(ctx, io.Discard, &slowReader{&endless{data: data}}, Options{})
+		}},
+		{"decompress", func(ctx context.Context) error {
+			return DecompressContext(ctx, io.Discard, &slowReader{bytes.NewReader(stream)}, Options{})
+		}},
+	}
+	goroutines := runtime.NumGoroutine()
+	for _, tt := range tests {
+		t.Run(tt.name+"/cancel", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(20*time.Millisecond, cancel)
+			if err := tt.run(ctx); !errors.Is(err, context.Canceled) {
+				t.Errorf("error %v, want context.Canceled", err)
+			}
+		})
+		t.Run(tt.name+"/deadline", func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			if err := tt.run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("error %v, want context.DeadlineExceeded", err)
+			}
+		})
+		t.Run(tt.name+"/done", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if err := tt.run(ctx); !errors.Is(err, context.Canceled) {
+				t.Errorf("error %v, want context.Canceled", err)
+			}
+		})
+	}
+
+	// nothing keeps running after the calls have returned
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > goroutines; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines, %d before", runtime.NumGoroutine(), goroutines)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestContextComplete(t *testing.T) {
+	data := testData(64 << 10)
+	for _, method := range methods {
+		var stream, out bytes.Buffer
+		if err := CompressContext(context.Background(), &stream, bytes.NewReader(data), Options{Method: method}); err != nil {
+			t.Fatal(err)
+		}
+		if err := DecompressContext(context.Background(), &out, &stream, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.Bytes(), data) {
+			t.Errorf("%s: round trip changed the data", method)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"huffman_coding/bits"
+	"math"
+)
+
+// A dictionary file stores the byte frequencies of training data:
+//
+//	magic    4 bytes  "HUFD"
+//	version  1 byte   dictVersion
+//	flags    1 byte   dictContexts if there are order-1 tables, the other bits must be 0
+//	id       4 bytes  big endian ID, the FNV-1a hash of the tables
+//	order-0  256 uvarint counts of the bytes
+//	order-1  only with dictContexts, for every preceding byte:
+//	         uvarint number of bytes seen after it,
+//	         then for each of them in ascending order a byte with the distance to the previous one minus 1
+//	         (or the byte itself for the first one) and an uvarint count
+const (
+	dictMagic    = "HUFD"
+	dictVersion  = 1
+	dictContexts = 1
+)
+
+// dictWeight is the total frequency a dictionary primes an adaptive model with.
+// Larger counts are scaled down, so the data being coded soon outweighs the training data.
+const dictWeight = 1 << 12
+
+var (
+	errDictFormat = errors.New("huffman: invalid dictionary")
+	// ErrDictionary is returned when reading a stream which was coded
+	// with a dictionary without being given the same one.
+	ErrDictionary = errors.New("huffman: wrong dictionary")
+)
+
+// Dictionary holds byte frequencies gathered from sample data,
+// used to prime the adaptive model through Options.Dictionary.
+// A Dictionary is identified by an ID derived from its content,
+// which streams coded with it record in their header.
+//
+// A Dictionary is read-only once built, so it can be shared by any number of streams.
+type Dictionary struct {
+	freqs [256]uint64
+	// order-1 frequencies indexed by the preceding byte, nil without contexts
+	contexts *[256][256]uint64
+	id       uint32
+}
+
+// Train builds a dictionary of the byte frequencies of samples.
+func Train(samples [][]byte) *Dictionary {
+	d := new(Dictionary)
+	for _, sample := range samples {
+		for _, b := range sample {
+			d.freqs[b]++
+		}
+	}
+	d.id = d.hash()
+	return d
+}
+
+// TrainContexts builds a dictionary of the byte frequencies of samples
+// together with order-1 tables of the frequencies following every byte.
+// The Huffman method then codes every byte with a model of its own for the preceding byte,
+// the first byte of a stream or sample is preceded by 0.
+func TrainContexts(samples [][]byte) *Dictionary {
+	d := &Dictionary{contexts: new([256][256]uint64)}
+	for _, sample := range samples {
+		prev := byte(0)
+		for _, b := range sample {
+			d.freqs[b]++
+			d.contexts[prev][b]++
+			prev = b
+		}
+	}
+	d.id = d.hash()
+	return d
+}
+
+// ID returns the content derived ID of d.
+func (d *Dictionary) ID() uint32 {
+	return d.id
+}
+
+// HasContexts tells if d has order-1 tables.
+func (d *Dictionary) HasContexts() bool {
+	return d.contexts != nil
+}
+
+// Freqs returns the frequencies of all bytes in the training data.
+func (d *Dictionary) Freqs() [256]uint64 {
+	return d.freqs
+}
+
+// Codebook returns the static codebook of the frequencies in d,
+// for using the dictionary as a static model instead of priming an adaptive one.
+func (d *Dictionary) Codebook() (*Codebook, error) {
+	freqs := make(map[rune]uint64)
+	for b, f := range d.freqs {
+		if f > 0 {
+			freqs[rune(b)] = f
+		}
+	}
+	return NewCodebook(freqs)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, giving the dictionary file.
+func (d *Dictionary) MarshalBinary() ([]byte, error) {
+	buf := []byte(dictMagic)
+	flags := byte(0)
+	if d.contexts != nil {
+		flags |= dictContexts
+	}
+	buf = append(buf, dictVersion, flags)
+	buf = binary.BigEndian.AppendUint32(buf, d.id)
+	return d.appendTables(buf), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, reading a dictionary file.
+// The ID stored in the file must match its content.
+func (d *Dictionary) UnmarshalBinary(data []byte) error {
+	if len(data) < len(dictMagic)+6 || string(data[:len(dictMagic)]) != dictMagic {
+		return errDictFormat
+	}
+	data = data[len(dictMagic):]
+	if data[0] != dictVersion {
+		return fmt.Errorf("%w: unsupported version %d", errDictFormat, data[0])
+	}
+	if data[1]&^dictContexts != 0 {
+		return fmt.Errorf("%w: unknown flags %#x", errDictFormat, data[1])
+	}
+	var nd Dictionary
+	if data[1]&dictContexts != 0 {
+		nd.contexts = new([256][256]uint64)
+	}
+	id := binary.BigEndian.Uint32(data[2:])
+	r := bytes.NewReader(data[6:])
+
+	var err error
+	for b := range nd.freqs {
+		if nd.freqs[b], err = binary.ReadUvarint(r); err != nil {
+			return errDictFormat
+		}
+	}
+	if nd.contexts != nil {
+		for prev := range nd.contexts {
+			n, err := binary.ReadUvarint(r)
+			if err != nil || n > 256 {
+				return errDictFormat
+			}
+			b := -1
+			for range n {
+				delta, err := r.ReadByte()
+				if err != nil {
+					return errDictFormat
+				}
+				if b += int(delta) + 1; b > 255 {
+					return errDictFormat
+				}
+				if nd.contexts[prev][b], err = binary.ReadUvarint(r); err != nil {
+					return errDictFormat
+				}
+			}
+		}
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%w: trailing data", errDictFormat)
+	}
+	if nd.id = nd.hash(); nd.id != id {
+		return fmt.Errorf("%w: ID %08x doesn't match the content", errDictFormat, id)
+	}
+	*d = nd
+	return nil
+}
+
+// appendTables appends the frequency tables in the format of the dictionary file.
+func (d *Dictionary) appendTables(buf []byte) []byte {
+	for _, f := range d.freqs {
+		buf = binary.AppendUvarint(buf, f)
+	}
+	if d.contexts == nil {
+		return buf
+	}
+	for _, table := range d.contexts {
+		n := 0
+		for _, f := range table {
+			if f > 0 {
+				n++
+			}
+		}
+		buf = binary.AppendUvarint(buf, uint64(n))
+		prev := -1
+		for b, f := range table {
+			if f > 0 {
+				buf = append(buf, byte(b-prev-1))
+				buf = binary.AppendUvarint(buf, f)
+				prev = b
+			}
+		}
+	}
+	return buf
+}
+
+// hash returns the FNV-1a hash of the tables, which is the ID of d.
+func (d *Dictionary) hash() uint32 {
+	h := fnv.New32a()
+	flags := byte(0)
+	if d.contexts != nil {
+		flags |= dictContexts
+	}
+	h.Write([]byte{flags})
+	h.Write(d.appendTables(nil))
+	return h.Sum32()
+}
+
+// primeFreqs scales counts down to a total of about weight,
+// keeping every byte which occurs at frequency 1 at least.
+func primeFreqs(counts *[256]uint64, weight uint64) (freqs [256]int) {
+	var total uint64
+	for _, c := range counts {
+		if total += c; total < c {
+			// saturate instead of overflowing on hostile dictionaries
+			total = math.MaxUint64
+			break
+		}
+	}
+	for b, c := range counts {
+		switch {
+		case c == 0:
+		case total <= weight:
+			freqs[b] = int(c)
+		default:
+			freqs[b] = int(max(c/(total/weight+1), 1))
+		}
+	}
+	return freqs
+}
+
+// usesContexts tells if streams of method coded with dict use its order-1 tables.
+func usesContexts(method Method, dict *Dictionary) bool {
+	return method == Huffman && dict != nil && dict.contexts != nil
+}
+
+// contextModel is the model of the Huffman method with a dictionary with order-1 tables:
+// an adaptive model per preceding byte, each primed with the table of its byte.
+type contextModel struct {
+	dict    *Dictionary
+	preseed bool
+	// models by preceding byte, created when first needed
+	models [256]*symbols
+	prev   byte
+}
+
+func newContextModel(dict *Dictionary, preseed bool) *contextModel {
+	return &contextModel{dict: dict, preseed: preseed}
+}
+
+// current returns the model of the current context.
+func (c *contextModel) current() *symbols {
+	s := c.models[c.prev]
+	if s == nil {
+		freqs := primeFreqs(&c.dict.contexts[c.prev], dictWeight)
+		s = newSymbolsFreqs(&freqs, c.preseed)
+		c.models[c.prev] = s
+	}
+	return s
+}
+
+// Code implements Model.
+func (c *contextModel) Code(char rune) (code uint64, length uint8, ok bool) {
+	return c.current().Code(char)
+}
+
+// Decode implements Model.
+func (c *contextModel) Decode(br *bits.Reader) (char rune, err error) {
+	return c.current().Decode(br)
+}
+
+// Update implements Model, switching to the context of char.
+func (c *contextModel) Update(char rune) {
+	c.current().Update(char)
+	c.prev = byte(char)
+}
+
+// Root returns the tree of the current context.
+func (c *contextModel) Root() *Node {
+	return c.current().Root()
+}
+
+// hash returns the hash of the tree of the current context.
+func (c *contextModel) hash() uint64 {
+	return c.current().hash()
+}
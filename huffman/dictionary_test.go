@@ -0,0 +1,112 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+var dictSamples = [][]byte{
+	[]byte("GET /index.html HTTP/1.1\r\nHost: example.com\r\nAccept: text/html\r\n\r\n"),
+	[]byte("GET /style.css HTTP/1.1\r\nHost: example.com\r\nAccept: text/css\r\n\r\n"),
+	[]byte("POST /form HTTP/1.1\r\nHost: example.com\r\nContent-Length: 0\r\n\r\n"),
+}
+
+// dictText is like the samples without being one of them.
+var dictText = []byte("GET /script.js HTTP/1.1\r\nHost: example.com\r\nAccept: text/javascript\r\n\r\n")
+
+func TestTrainContexts(t *testing.T) {
+	d := TrainContexts([][]byte{[]byte("abab"), []byte("ba")})
+	if !d.HasContexts() || Train(nil).HasContexts() {
+		t.Error("HasContexts wrong")
+	}
+	if freqs := d.Freqs(); freqs['a'] != 3 || freqs['b'] != 3 {
+		t.Errorf("Freqs = %d a, %d b, want 3 each", freqs['a'], freqs['b'])
+	}
+	// every sample starts after a 0
+	for _, tt := range []struct {
+		prev, b byte
+		want    uint64
+	}{
+		{0, 'a', 1},
+		{0, 'b', 1},
+		{'a', 'b', 2},
+		{'b', 'a', 2},
+		{'a', 'a', 0},
+	} {
+		if got := d.contexts[tt.prev][tt.b]; got != tt.want {
+			t.Errorf("%q after %q seen %d times, want %d", tt.b, tt.prev, got, tt.want)
+		}
+	}
+	if Train(dictSamples).ID() == TrainContexts(dictSamples).ID() {
+		t.Error("dictionaries with and without contexts have the same ID")
+	}
+}
+
+func TestDictionaryMarshalBinary(t *testing.T) {
+	for _, d := range []*Dictionary{Train(dictSamples), TrainContexts(dictSamples), Train(nil)} {
+		data, err := d.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Dictionary
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if got.ID() != d.ID() || got.HasContexts() != d.HasContexts() || got.Freqs() != d.Freqs() {
+			t.Errorf("dictionary %08x read back as %08x", d.ID(), got.ID())
+		}
+		if d.HasContexts() && *got.contexts != *d.contexts {
+			t.Errorf("dictionary %08x: order-1 tables changed", d.ID())
+		}
+
+		for n := range len(data) {
+			var got Dictionary
+			if err := got.UnmarshalBinary(data[:n]); err == nil {
+				t.Errorf("dictionary truncated to %d of %d bytes read without error", n, len(data))
+			}
+		}
+		// the ID covers everything after it, so no change goes unnoticed
+		for i := range data {
+			corrupt := bytes.Clone(data)
+			corrupt[i] ^= 0x40
+			var got Dictionary
+			if err := got.UnmarshalBinary(corrupt); err == nil {
+				t.Errorf("dictionary with byte %d changed read without error", i)
+			}
+		}
+		var got2 Dictionary
+		if err := got2.UnmarshalBinary(append(bytes.Clone(data), 0)); err == nil {
+			t.Error("dictionary with trailing data read without error")
+		}
+	}
+}
+
+func TestDictionaryStreams(t *testing.T) {
+	for _, d := range []*Dictionary{Train(dictSamples), TrainContexts(dictSamples)} {
+		other := Train([][]byte{[]byte("something else")})
+		for _, method := range methods {
+			opts := Options{Method: method, Dictionary: d}
+			stream := compressed(t, opts, dictText)
+			got, err := io.ReadAll(NewReaderOptions(bytes.NewReader(stream), Options{Dictionary: d}))
+			if err != nil || !bytes.Equal(got, dictText) {
+				t.Errorf("%s, %08x: got %q, %v", method, d.ID(), got, err)
+			}
+			if method == RANS {
+				// ignores dictionaries
+				continue
+			}
+			if plain := compressed(t, Options{Method: method}, dictText); len(stream) >= len(plain) {
+				t.Errorf("%s, %08x: %d bytes with the dictionary, %d without", method, d.ID(), len(stream), len(plain))
+			}
+
+			for name, wrong := range map[string]*Dictionary{"no": nil, "another": other} {
+				_, err := io.ReadAll(NewReaderOptions(bytes.NewReader(stream), Options{Dictionary: wrong}))
+				if !errors.Is(err, ErrDictionary) {
+					t.Errorf("%s, %08x: read with %s dictionary: %v, want ErrDictionary", method, d.ID(), name, err)
+				}
+			}
+		}
+	}
+}
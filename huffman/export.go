@@ -0,0 +1,87 @@
+package huffman
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteDOT writes the subtree of n to w as a Graphviz DOT digraph.
+// Edges are labeled with the bit they stand for,
+// leaves with their character, frequency and code.
+func (n *Node) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph huffman {")
+	fmt.Fprintln(bw, "\tnode [shape=circle];")
+
+	id := 0
+	// traverse writes the node with the given code and returns its id.
+	var traverse func(n *Node, code uint64, count uint8) int
+
+	traverse = func(n *Node, code uint64, count uint8) int {
+		nid := id
+		id++
+		if n.Left == nil {
+			// it's a leaf
+			label := dotEscape(symbolName(n.Char)) + `\n` + fmt.Sprint(n.Freq) + `\n` + formatCode(code, count)
+			fmt.Fprintf(bw, "\tn%d [shape=box, label=\"%s\"];\n", nid, label)
+			return nid
+		}
+		fmt.Fprintf(bw, "\tn%d [label=\"%d\"];\n", nid, n.Freq)
+		count++
+		left := traverse(n.Left, code<<1, count)
+		right := traverse(n.Right, code<<1+1, count)
+		fmt.Fprintf(bw, "\tn%d -> n%d [label=\"0\"];\n", nid, left)
+		fmt.Fprintf(bw, "\tn%d -> n%d [label=\"1\"];\n", nid, right)
+		return nid
+	}
+
+	traverse(n, 0, 0)
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// dotEscape escapes s to be used inside a double-quoted DOT string.
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// jsonNode is the JSON form of a Node.
+// Only leaves have a symbol and a code.
+type jsonNode struct {
+	Freq   int       `json:"freq"`
+	Symbol string    `json:"symbol,omitempty"`
+	Char   *rune     `json:"char,omitempty"`
+	Code   string    `json:"code,omitempty"`
+	Left   *jsonNode `json:"left,omitempty"`
+	Right  *jsonNode `json:"right,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+// The subtree of n is encoded as nested objects, Parent links are left out.
+func (n *Node) MarshalJSON() ([]byte, error) {
+	var traverse func(n *Node, code uint64, count uint8) *jsonNode
+
+	traverse = func(n *Node, code uint64, count uint8) *jsonNode {
+		if n.Left == nil {
+			// it's a leaf
+			char := n.Char
+			return &jsonNode{
+				Freq:   n.Freq,
+				Symbol: symbolName(n.Char),
+				Char:   &char,
+				Code:   formatCode(code, count),
+			}
+		}
+		count++
+		return &jsonNode{
+			Freq:  n.Freq,
+			Left:  traverse(n.Left, code<<1, count),
+			Right: traverse(n.Right, code<<1+1, count),
+		}
+	}
+
+	return json.Marshal(traverse(n, 0, 0))
+}
@@ -0,0 +1,78 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// exportTree returns a tree of fixed shape, with leaves needing escapes in DOT.
+func exportTree() *Node {
+	root := &Node{Freq: 5}
+	quote := &Node{Freq: 3, Char: '"'}
+	inner := &Node{Freq: 2}
+	backslash := &Node{Freq: 1, Char: '\\'}
+	end := &Node{Freq: 1, Char: eof}
+	root.Left, root.Right = quote, inner
+	inner.Left, inner.Right = backslash, end
+	quote.Parent, inner.Parent = root, root
+	backslash.Parent, end.Parent = inner, inner
+	return root
+}
+
+func TestWriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := exportTree().WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph huffman {
+	node [shape=circle];
+	n0 [label="5"];
+	n1 [shape=box, label="'\"'\n3\n0"];
+	n2 [label="2"];
+	n3 [shape=box, label="'\\\\'\n1\n10"];
+	n4 [shape=box, label="<eof>\n1\n11"];
+	n2 -> n3 [label="0"];
+	n2 -> n4 [label="1"];
+	n0 -> n1 [label="0"];
+	n0 -> n2 [label="1"];
+}
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	// a single leaf has an empty code
+	buf.Reset()
+	if err := (&Node{Freq: 1, Char: 'a'}).WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want = "digraph huffman {\n\tnode [shape=circle];\n\tn0 [shape=box, label=\"'a'\\n1\\n\"];\n}\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestNodeMarshalJSON(t *testing.T) {
+	data, err := json.Marshal(exportTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"freq":5,` +
+		`"left":{"freq":3,"symbol":"'\"'","char":34,"code":"0"},` +
+		`"right":{"freq":2,` +
+		`"left":{"freq":1,"symbol":"'\\\\'","char":92,"code":"10"},` +
+		`"right":{"freq":1,"symbol":"\u003ceof\u003e","char":2147483646,"code":"11"}}}`
+	if string(data) != want {
+		t.Errorf("got  %s\nwant %s", data, want)
+	}
+
+	// the char of a leaf is kept even if it's 0
+	data, err = json.Marshal(&Node{Freq: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"freq":1,"symbol":"'\\x00'","char":0}`; string(data) != want {
+		t.Errorf("got  %s\nwant %s", data, want)
+	}
+}
@@ -0,0 +1,214 @@
+package huffman
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Suffix is the name suffix of compressed files in the file systems of NewFS.
+const Suffix = ".huff"
+
+// NewFS returns a file system showing the compressed files of fsys decompressed.
+// Opening name opens name+Suffix if there's such a file and decodes it while reading,
+// other files and directories are passed through.
+// Directory listings show compressed files without the suffix,
+// hiding uncompressed files of the same name.
+//
+// The sizes of compressed files are taken from their headers,
+// files compressed without recording their size are decoded to find it out,
+// once per open file and directory entry.
+func NewFS(fsys fs.FS) fs.FS {
+	return NewFSOptions(fsys, Options{})
+}
+
+// NewFSOptions returns the file system of NewFS, decoding with Readers configured by opts.
+func NewFSOptions(fsys fs.FS, opts Options) fs.FS {
+	return &huffFS{fsys: fsys, opts: opts}
+}
+
+type huffFS struct {
+	fsys fs.FS
+	opts Options
+}
+
+// Open implements fs.FS.
+func (h *huffFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name != "." {
+		f, err := h.fsys.Open(name + Suffix)
+		if err == nil {
+			fi, err := f.Stat()
+			if err == nil && !fi.IsDir() {
+				return &compressedFile{File: f, r: NewReaderOptions(f, h.opts), fsys: h, name: name, fi: fi, size: -1}, nil
+			}
+			f.Close()
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if dir, ok := f.(fs.ReadDirFile); ok {
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if fi.IsDir() {
+			return &dirFile{ReadDirFile: dir, fsys: h, name: name}, nil
+		}
+	}
+	return f, nil
+}
+
+// size returns the uncompressed size of the named compressed file, name without Suffix.
+func (h *huffFS) size(name string) (int64, error) {
+	f, err := h.fsys.Open(name + Suffix)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	r := NewReaderOptions(f, h.opts)
+	size, err := r.Size()
+	if err != nil || size >= 0 {
+		return size, err
+	}
+	return io.Copy(io.Discard, r)
+}
+
+// compressedFile is a file of the wrapped file system decoded while reading.
+type compressedFile struct {
+	fs.File
+	r    *Reader
+	fsys *huffFS
+	// name without Suffix and info of the compressed file
+	name string
+	fi   fs.FileInfo
+	// uncompressed size, -1 until Stat has found it out
+	size int64
+}
+
+func (f *compressedFile) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = &fs.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	return n, err
+}
+
+func (f *compressedFile) Stat() (fs.FileInfo, error) {
+	if f.size < 0 {
+		size, err := f.fsys.size(f.name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "stat", Path: f.name, Err: err}
+		}
+		f.size = size
+	}
+	return &fileInfo{FileInfo: f.fi, name: path.Base(f.name), size: f.size}, nil
+}
+
+// fileInfo is the info of a compressed file, showing its uncompressed name and size.
+type fileInfo struct {
+	fs.FileInfo
+	name string
+	size int64
+}
+
+func (fi *fileInfo) Name() string { return fi.name }
+func (fi *fileInfo) Size() int64  { return fi.size }
+
+// dirFile is a directory of the wrapped file system, listing compressed files without Suffix.
+type dirFile struct {
+	fs.ReadDirFile
+	fsys *huffFS
+	name string
+	// all the entries, read by the first call of ReadDir
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		if err := d.readAll(); err != nil {
+			return nil, err
+		}
+		d.read = true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// readAll reads the entries of the directory, renaming compressed files.
+func (d *dirFile) readAll() error {
+	entries, err := d.ReadDirFile.ReadDir(-1)
+	if err != nil {
+		return err
+	}
+	compressed := make(map[string]bool)
+	for _, e := range entries {
+		if base, ok := strings.CutSuffix(e.Name(), Suffix); ok && base != "" && !e.IsDir() {
+			compressed[base] = true
+		}
+	}
+	d.entries = make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if compressed[name] {
+			// hidden by the compressed file of the same name
+			continue
+		}
+		if base, ok := strings.CutSuffix(name, Suffix); ok && compressed[base] {
+			e = &dirEntry{DirEntry: e, fsys: d.fsys, name: path.Join(d.name, base)}
+		}
+		d.entries = append(d.entries, e)
+	}
+	slices.SortFunc(d.entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return nil
+}
+
+// dirEntry is the directory entry of a compressed file, showing its uncompressed name and size.
+type dirEntry struct {
+	fs.DirEntry
+	fsys *huffFS
+	// name without Suffix
+	name string
+	// set by the first successful call of Info
+	info fs.FileInfo
+}
+
+func (e *dirEntry) Name() string { return path.Base(e.name) }
+
+func (e *dirEntry) Info() (fs.FileInfo, error) {
+	if e.info != nil {
+		return e.info, nil
+	}
+	fi, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	size, err := e.fsys.size(e.name)
+	if err != nil {
+		return nil, err
+	}
+	e.info = &fileInfo{FileInfo: fi, name: e.Name(), size: size}
+	return e.info, nil
+}
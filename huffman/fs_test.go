@@ -0,0 +1,85 @@
+package huffman
+
+import (
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	text := []byte("abracadabra, abracadabra! the quick brown fox jumps over the lazy dog")
+	mapFS := fstest.MapFS{
+		"sized.txt" + Suffix:         {Data: compressed(t, Options{Size: int64(len(text))}, text)},
+		"unsized.txt" + Suffix:       {Data: compressed(t, Options{Method: Range}, text)},
+		"plain.txt":                  {Data: []byte("not compressed")},
+		"dir/nested.bin" + Suffix:    {Data: compressed(t, Options{Method: RANS}, text[:10])},
+		"dir/hidden.txt":             {Data: []byte("hidden by the compressed file")},
+		"dir/hidden.txt" + Suffix:    {Data: compressed(t, Options{}, text[10:])},
+		"dir/sub/empty.txt" + Suffix: {Data: compressed(t, Options{})},
+	}
+	fsys := NewFS(mapFS)
+	if err := fstest.TestFS(fsys, "sized.txt", "unsized.txt", "plain.txt", "dir/nested.bin", "dir/hidden.txt", "dir/sub/empty.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"sized.txt":         string(text),
+		"unsized.txt":       string(text),
+		"plain.txt":         "not compressed",
+		"dir/nested.bin":    string(text[:10]),
+		"dir/hidden.txt":    string(text[10:]),
+		"dir/sub/empty.txt": "",
+	} {
+		got, err := fs.ReadFile(fsys, name)
+		if err != nil || string(got) != want {
+			t.Errorf("ReadFile(%q) = %q, %v, want %q", name, got, err, want)
+		}
+		fi, err := fs.Stat(fsys, name)
+		if err != nil || fi.Size() != int64(len(want)) {
+			t.Errorf("Stat(%q) size = %v, %v, want %d", name, fi.Size(), err, len(want))
+		}
+	}
+}
+
+// countingFS counts the files opened in it.
+type countingFS struct {
+	fs.FS
+	opened int
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	c.opened++
+	return c.FS.Open(name)
+}
+
+func TestFSSizeCached(t *testing.T) {
+	cfs := &countingFS{FS: fstest.MapFS{"a.txt" + Suffix: {Data: compressed(t, Options{}, []byte("unsized"))}}}
+	fsys := NewFS(cfs)
+
+	f, err := fsys.Open("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ReadDir = %v, %v", entries, err)
+	}
+	opened := cfs.opened
+	for range 3 {
+		if fi, err := f.Stat(); err != nil || fi.Size() != 7 {
+			t.Fatalf("Stat = %v, %v", fi, err)
+		}
+		if fi, err := entries[0].Info(); err != nil || fi.Size() != 7 {
+			t.Fatalf("Info = %v, %v", fi, err)
+		}
+	}
+	// one decoding to find out the size for the open file and one for the directory entry
+	if n := cfs.opened - opened; n != 2 {
+		t.Errorf("%d files opened to find out the size, want 2", n)
+	}
+	if got, err := io.ReadAll(f); err != nil || string(got) != "unsized" {
+		t.Errorf("ReadAll = %q, %v", got, err)
+	}
+}
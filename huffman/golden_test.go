@@ -0,0 +1,140 @@
+package huffman
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// goldenInputs are compressed by TestGolden.
+var goldenInputs = map[string][]byte{
+	"empty": {},
+	"byte":  {'x'},
+	// many symbols of the same frequency, so the streams depend on how ties are broken
+	"ties": []byte(strings.Repeat("abcdefgh", 64) + strings.Repeat("hgfedcba ", 32)),
+	"bytes": func() []byte {
+		all := make([]byte, 256)
+		for i := range all {
+			all[i] = byte(i)
+		}
+		return all
+	}(),
+}
+
+// goldenText is compressed with every set of options by TestGolden.
+var goldenText = []byte("GET /script.js HTTP/1.1\r\nHost: example.com\r\nAccept: text/javascript\r\n\r\n")
+
+// goldenOptions are the options TestGolden compresses goldenText with, each setting other header flags.
+// Method is set by the test, options not supported by a method are skipped.
+var goldenOptions = map[string]struct {
+	opts Options
+	// flushes splits goldenText into that many chunks plus one, with the Writer flushed after each
+	flushes int
+	methods []Method
+}{
+	"default":  {Options{}, 0, methods},
+	"size":     {Options{Size: int64(len(goldenText))}, 0, methods},
+	"flushes":  {Options{}, 3, methods},
+	"preseed":  {Options{Preseed: true}, 0, []Method{Huffman, Range}},
+	"dict":     {Options{Dictionary: Train(dictSamples)}, 0, []Method{Huffman, Range}},
+	"contexts": {Options{Dictionary: TrainContexts(dictSamples)}, 0, []Method{Huffman}},
+	// a custom model, coded without flagUnseenLiterals
+	"model": {Options{Model: goldenCodebook()}, 0, []Method{Huffman}},
+	// all of them at once
+	"all": {Options{Preseed: true, Dictionary: Train(dictSamples), Size: int64(len(goldenText))}, 2, []Method{Huffman, Range}},
+}
+
+// goldenCodebook returns a Codebook of the frequencies of goldenText.
+func goldenCodebook() *Codebook {
+	freqs := make(map[rune]uint64)
+	for _, b := range goldenText {
+		freqs[rune(b)]++
+	}
+	c, err := NewCodebook(freqs)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// goldenCase is a stream TestGolden checks against testdata/golden/<name>.huf.
+type goldenCase struct {
+	name    string
+	input   []byte
+	opts    Options
+	flushes int
+}
+
+func goldenCases() []goldenCase {
+	var cases []goldenCase
+	for _, method := range methods {
+		for name, input := range goldenInputs {
+			cases = append(cases, goldenCase{method.String() + "-" + name, input, Options{Method: method}, 0})
+		}
+		for name, g := range goldenOptions {
+			for _, m := range g.methods {
+				if m == method {
+					opts := g.opts
+					opts.Method = method
+					cases = append(cases, goldenCase{method.String() + "-text-" + name, goldenText, opts, g.flushes})
+				}
+			}
+		}
+	}
+	return cases
+}
+
+// TestGolden compares the streams written by Writers with the ones checked in,
+// and reads back those. They change with the bitstream, which shouldn't happen without a new format version.
+// Run the tests with -update to rewrite them.
+func TestGolden(t *testing.T) {
+	for _, c := range goldenCases() {
+		t.Run(c.name, func(t *testing.T) {
+			var chunks [][]byte
+			for i := range c.flushes + 1 {
+				chunks = append(chunks, c.input[i*len(c.input)/(c.flushes+1):(i+1)*len(c.input)/(c.flushes+1)])
+			}
+			data := compressed(t, c.opts, chunks...)
+			name := filepath.Join("testdata", "golden", c.name+".huf")
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(name), 0o777); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(name, data, 0o666); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, want) {
+				t.Errorf("compressed differently than %s:\n%s", name, bytesDiff(data, want))
+			}
+
+			got, err := io.ReadAll(NewReaderOptions(bytes.NewReader(want), Options{Model: c.opts.Model, Dictionary: c.opts.Dictionary}))
+			if err != nil || !bytes.Equal(got, c.input) {
+				t.Errorf("%s decompressed to %d bytes, %v, want the %d of the input", name, len(got), err, len(c.input))
+			}
+		})
+	}
+}
+
+// bytesDiff describes where got and want start to differ, with the bytes around it in hex.
+func bytesDiff(got, want []byte) string {
+	i := 0
+	for i < len(got) && i < len(want) && got[i] == want[i] {
+		i++
+	}
+	start := max(i-8, 0)
+	around := func(b []byte) []byte { return b[start:min(i+8, len(b))] }
+	return fmt.Sprintf("first difference at offset %d of %d bytes, %d wanted\n   got % x\n  want % x",
+		i, len(got), len(want), around(got), around(want))
+}
@@ -0,0 +1,171 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Every stream starts with a header:
+//
+//	magic   4 bytes  "HUFF"
+//	version 1 byte   formatVersion
+//	method  1 byte   Method used to code the symbols
+//	flags   1 byte   flag* bits, the others must be 0
+//	dict    4 bytes  big endian ID of the Dictionary, only with flagDictionary
+//	size    uvarint  number of bytes of the uncompressed data, only with flagSize
+//
+// The coded symbols follow the header.
+const (
+	magic         = "HUFF"
+	formatVersion = 2
+	headerSize    = len(magic) + 3
+)
+
+// Header flags. All but flagSize are only used by the methods using the adaptive model.
+const (
+	// flagUnseenLiterals codes literals relative to the bytes not seen yet, see unseenBytes.
+	// Without it literals take 8 bits.
+	flagUnseenLiterals = 1 << iota
+	// flagPreseeded starts the adaptive model with all bytes at frequency 1, so nothing is ever escaped.
+	flagPreseeded
+	// flagDictionary primes the adaptive model with a Dictionary, whose ID follows the flags.
+	flagDictionary
+	// flagSize records the size of the uncompressed data, which follows the dictionary ID.
+	flagSize
+
+	knownFlags = flagUnseenLiterals | flagPreseeded | flagDictionary | flagSize
+)
+
+// ErrHeader is returned when reading data that doesn't start with a valid header.
+var ErrHeader = errors.New("huffman: invalid header")
+
+// Method is the entropy coder used to code the symbols of the adaptive model.
+type Method uint8
+
+const (
+	// Huffman codes every symbol with its code from the adaptive Huffman tree.
+	Huffman Method = iota
+	// Range codes every symbol with a range coder, using the frequencies of the adaptive model directly.
+	// It gets closer to the entropy than Huffman on skewed data, at the cost of speed.
+	Range
+	// RANS codes blocks of data with interleaved rANS and a static frequency table per block.
+	// It doesn't use the adaptive model at all.
+	RANS
+	numMethods
+)
+
+var methodNames = [numMethods]string{
+	Huffman: "huffman",
+	Range:   "range",
+	RANS:    "rans",
+}
+
+func (m Method) String() string {
+	if m < numMethods {
+		return methodNames[m]
+	}
+	return fmt.Sprintf("Method(%d)", uint8(m))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (m Method) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (m *Method) UnmarshalText(text []byte) (err error) {
+	*m, err = ParseMethod(string(text))
+	return err
+}
+
+// ParseMethod returns the Method with the given name.
+func ParseMethod(name string) (Method, error) {
+	for m, n := range methodNames {
+		if n == name {
+			return Method(m), nil
+		}
+	}
+	return 0, fmt.Errorf("huffman: unknown method %q", name)
+}
+
+// Methods returns all supported methods.
+func Methods() []Method {
+	methods := make([]Method, numMethods)
+	for i := range methods {
+		methods[i] = Method(i)
+	}
+	return methods
+}
+
+type header struct {
+	method Method
+	flags  byte
+	// ID of the dictionary, only with flagDictionary
+	dict uint32
+	// size of the uncompressed data, only with flagSize
+	size uint64
+}
+
+func (h *header) write(w io.Writer) error {
+	buf := make([]byte, 0, headerSize+4+binary.MaxVarintLen64)
+	buf = append(buf, magic...)
+	buf = append(buf, formatVersion, byte(h.method), h.flags)
+	if h.flags&flagDictionary != 0 {
+		buf = binary.BigEndian.AppendUint32(buf, h.dict)
+	}
+	if h.flags&flagSize != 0 {
+		buf = binary.AppendUvarint(buf, h.size)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func (h *header) read(r interface {
+	io.Reader
+	io.ByteReader
+}) error {
+	buf := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrHeader
+		}
+		return err
+	}
+	if string(buf[:len(magic)]) != magic {
+		return ErrHeader
+	}
+	buf = buf[len(magic):]
+	if buf[0] != formatVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrHeader, buf[0])
+	}
+	if h.method = Method(buf[1]); h.method >= numMethods {
+		return fmt.Errorf("%w: unknown method %d", ErrHeader, buf[1])
+	}
+	if h.flags = buf[2]; h.flags&^knownFlags != 0 || (h.method == RANS && h.flags&^flagSize != 0) {
+		return fmt.Errorf("%w: unknown flags %#x", ErrHeader, h.flags)
+	}
+	if h.flags&flagDictionary != 0 {
+		var id [4]byte
+		if _, err := io.ReadFull(r, id[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return ErrHeader
+			}
+			return err
+		}
+		h.dict = binary.BigEndian.Uint32(id[:])
+	}
+	if h.flags&flagSize != 0 {
+		size, err := binary.ReadUvarint(r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF || (err == nil && size > math.MaxInt64) {
+			return ErrHeader
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrHeader, err)
+		}
+		h.size = size
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestMaxSize(t *testing.T) {
+	data := testData(2*ransBlockSize + 100)
+	for _, method := range methods {
+		stream := compressed(t, Options{Method: method}, data)
+		for _, max := range []int64{1, 1000, ransBlockSize, ransBlockSize + 1, int64(len(data)) - 1} {
+			opts := Options{MaxSize: max}
+			// Read, with the bulk copies of RANS blocks
+			got, err := io.ReadAll(NewReaderOptions(bytes.NewReader(stream), opts))
+			if !errors.Is(err, ErrLimitExceeded) || !bytes.Equal(got, data[:max]) {
+				t.Errorf("%s: Read with MaxSize %d: %d bytes, %v", method, max, len(got), err)
+			}
+			// WriteTo, writing RANS blocks directly
+			var buf bytes.Buffer
+			_, err = NewReaderOptions(bytes.NewReader(stream), opts).WriteTo(&buf)
+			if !errors.Is(err, ErrLimitExceeded) || !bytes.Equal(buf.Bytes(), data[:max]) {
+				t.Errorf("%s: WriteTo with MaxSize %d: %d bytes, %v", method, max, buf.Len(), err)
+			}
+			// ReadByte
+			r := NewReaderOptions(bytes.NewReader(stream), opts)
+			var n int64
+			for ; ; n++ {
+				if _, err = r.ReadByte(); err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, ErrLimitExceeded) || n != max {
+				t.Errorf("%s: ReadByte with MaxSize %d: %d bytes, %v", method, max, n, err)
+			}
+		}
+
+		got, err := io.ReadAll(NewReaderOptions(bytes.NewReader(stream), Options{MaxSize: int64(len(data))}))
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: MaxSize of exactly the size: %d bytes, %v", method, len(got), err)
+		}
+	}
+}
+
+func TestMaxRatio(t *testing.T) {
+	// compresses to at most a bit per byte with every method
+	zeros := make([]byte, ratioAllowance+ratioAllowance/4)
+	// compresses less than 2:1
+	text := testData(ratioAllowance + ratioAllowance/4)
+	for _, method := range methods {
+		stream := compressed(t, Options{Method: method}, zeros)
+		got, err := io.ReadAll(NewReaderOptions(bytes.NewReader(stream), Options{MaxRatio: 4}))
+		if !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%s: %d zeros compressed to %d bytes: %v, want ErrLimitExceeded", method, len(zeros), len(stream), err)
+		}
+		if len(got) < ratioAllowance {
+			t.Errorf("%s: stopped after %d bytes, within the allowance", method, len(got))
+		}
+	}
+
+	// the ratio is checked the same for every method
+	stream := compressed(t, Options{Method: RANS}, text)
+	got, err := io.ReadAll(NewReaderOptions(bytes.NewReader(stream), Options{MaxRatio: 4}))
+	if err != nil || !bytes.Equal(got, text) {
+		t.Errorf("text within MaxRatio: %d bytes, %v", len(got), err)
+	}
+}
+
+func TestAnalyzeCompressedLimits(t *testing.T) {
+	data := testData(10000)
+	stream := compressed(t, Options{}, data)
+	if _, err := AnalyzeCompressedOptions(bytes.NewReader(stream), Options{MaxSize: 1000}); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("AnalyzeCompressedOptions with MaxSize: %v, want ErrLimitExceeded", err)
+	}
+	st, err := AnalyzeCompressedOptions(bytes.NewReader(stream), Options{MaxSize: int64(len(data))})
+	if err != nil || st.Uncompressed != int64(len(data)) || st.Compressed != int64(len(stream)) {
+		t.Errorf("AnalyzeCompressedOptions = %+v, %v", st, err)
+	}
+}
@@ -0,0 +1,121 @@
+package huffman
+
+import (
+	"errors"
+	"huffman_coding/bits"
+)
+
+var errNoUnseen = errors.New("huffman: literal of a byte which has been seen already")
+
+// unseenBytes is the set of bytes which haven't been coded as literals yet.
+// Literals are coded relative to it: the first literal of a stream can be any of 256 bytes,
+// but the last one is the only byte left and takes no bits at all.
+type unseenBytes struct {
+	seen  [256]bool
+	count int
+}
+
+func newUnseenBytes() *unseenBytes {
+	return &unseenBytes{count: 256}
+}
+
+// index returns the position of b among the unseen bytes in ascending order.
+func (u *unseenBytes) index(b byte) int {
+	i := 0
+	for c := range int(b) {
+		if !u.seen[c] {
+			i++
+		}
+	}
+	return i
+}
+
+// byteAt returns the unseen byte at position i in ascending order.
+func (u *unseenBytes) byteAt(i int) (b byte, ok bool) {
+	for c := range 256 {
+		if u.seen[c] {
+			continue
+		}
+		if i == 0 {
+			return byte(c), true
+		}
+		i--
+	}
+	return 0, false
+}
+
+// remove marks b as seen.
+func (u *unseenBytes) remove(b byte) {
+	if !u.seen[b] {
+		u.seen[b] = true
+		u.count--
+	}
+}
+
+// removeKnown marks the bytes the adaptive model s already knows as seen,
+// since they are never escaped. A nil s knows nothing.
+func (u *unseenBytes) removeKnown(s *symbols) {
+	if s == nil {
+		return
+	}
+	for _, leaf := range s.leaves[:s.nleaves] {
+		if leaf < 256 {
+			u.remove(byte(leaf))
+		}
+	}
+}
+
+// truncatedBinary returns the truncated binary code of i out of n values, n > 0.
+// The first 2^(k+1)-n values get k bits, the rest k+1 bits, where k = floor(log2(n)):
+//
+//	n = 5, k = 2, 3 short codes
+//	0 -> 00, 1 -> 01, 2 -> 10, 3 -> 110, 4 -> 111
+func truncatedBinary(i, n int) (code uint64, count uint8) {
+	k := uint8(0)
+	for 2<<k <= n {
+		k++
+	}
+	short := 2<<k - n
+	if i < short {
+		return uint64(i), k
+	}
+	return uint64(i + short), k + 1
+}
+
+// truncatedBinaryLength returns the number of bits of the truncated binary code of i out of n values.
+func truncatedBinaryLength(i, n int) uint8 {
+	_, count := truncatedBinary(i, n)
+	return count
+}
+
+// readTruncatedBinary reads a value coded by truncatedBinary with the same n.
+func readTruncatedBinary(br *bits.Reader, n int) (int, error) {
+	k := uint8(0)
+	for 2<<k <= n {
+		k++
+	}
+	short := 2<<k - n
+	v := 0
+	for range k {
+		bit, err := br.ReadOneBit()
+		if err != nil {
+			return 0, err
+		}
+		v <<= 1
+		if bit {
+			v |= 1
+		}
+	}
+	if v < short {
+		return v, nil
+	}
+	bit, err := br.ReadOneBit()
+	if err != nil {
+		return 0, err
+	}
+	v <<= 1
+	if bit {
+		v |= 1
+	}
+	return v - short, nil
+}
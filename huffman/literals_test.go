@@ -0,0 +1,131 @@
+package huffman
+
+import (
+	"bytes"
+	"huffman_coding/bits"
+	"testing"
+)
+
+func TestTruncatedBinary(t *testing.T) {
+	for _, tt := range []struct {
+		n    int
+		want []string
+	}{
+		{1, []string{""}},
+		{2, []string{"0", "1"}},
+		{3, []string{"0", "10", "11"}},
+		{5, []string{"00", "01", "10", "110", "111"}},
+		{6, []string{"00", "01", "100", "101", "110", "111"}},
+		{8, []string{"000", "001", "010", "011", "100", "101", "110", "111"}},
+	} {
+		for i, want := range tt.want {
+			if got := formatCode(truncatedBinary(i, tt.n)); got != want {
+				t.Errorf("truncatedBinary(%d, %d) = %q, want %q", i, tt.n, got, want)
+			}
+		}
+	}
+
+	for n := 1; n <= 256; n++ {
+		// a complete prefix code of lengths k and k+1, read back by readTruncatedBinary
+		var buf bytes.Buffer
+		bw := bits.NewWriter(&buf)
+		kraft := 0.0
+		minLength, maxLength := uint8(64), uint8(0)
+		codes := make(map[string]bool)
+		for i := range n {
+			code, count := truncatedBinary(i, n)
+			if truncatedBinaryLength(i, n) != count {
+				t.Fatalf("truncatedBinaryLength(%d, %d) = %d, the code has %d bits", i, n, truncatedBinaryLength(i, n), count)
+			}
+			for s := range codes {
+				if c := formatCode(code, count); len(s) <= len(c) && c[:len(s)] == s || len(c) < len(s) && s[:len(c)] == c {
+					t.Fatalf("n = %d: codes %s and %s are prefixes", n, s, c)
+				}
+			}
+			codes[formatCode(code, count)] = true
+			kraft += 1 / float64(uint64(1)<<count)
+			minLength, maxLength = min(minLength, count), max(maxLength, count)
+			if err := bw.WriteBits(code, count); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if kraft != 1 || maxLength-minLength > 1 {
+			t.Errorf("n = %d: Kraft sum %g, lengths from %d to %d", n, kraft, minLength, maxLength)
+		}
+		if err := bw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		br := bits.NewReader(&buf)
+		for i := range n {
+			if got, err := readTruncatedBinary(br, n); err != nil || got != i {
+				t.Fatalf("n = %d: read %d, %v, want %d", n, got, err, i)
+			}
+		}
+	}
+}
+
+func TestReadTruncatedBinaryEOF(t *testing.T) {
+	// the last values out of 5 take 3 bits, but only 2 are left
+	br := bits.NewReader(bytes.NewReader([]byte{0b00000011}))
+	br.ReadBits(6)
+	if _, err := readTruncatedBinary(br, 5); err == nil {
+		t.Error("read a code past the end of the input")
+	}
+	if _, err := readTruncatedBinary(bits.NewReader(bytes.NewReader(nil)), 5); err == nil {
+		t.Error("read a code from no input")
+	}
+}
+
+func TestUnseenBytes(t *testing.T) {
+	u := newUnseenBytes()
+	for _, b := range []byte{'b', 0, 255, 'a'} {
+		u.remove(b)
+	}
+	u.remove('a')
+	if u.count != 252 {
+		t.Errorf("%d bytes unseen, want 252", u.count)
+	}
+	for i, b := range []byte{1, 2, 'c', 254} {
+		want := []int{0, 1, 'c' - 3, 251}[i]
+		if got := u.index(b); got != want {
+			t.Errorf("index(%d) = %d, want %d", b, got, want)
+		}
+		if got, ok := u.byteAt(want); !ok || got != b {
+			t.Errorf("byteAt(%d) = %d, %v, want %d", want, got, ok, b)
+		}
+	}
+	if _, ok := u.byteAt(252); ok {
+		t.Error("byteAt beyond the unseen bytes found one")
+	}
+
+	// the bytes a primed model knows are never escaped
+	s := newSymbolsFreqs(&[256]int{'a': 1, 'b': 2, 'c': 3}, false)
+	u = newUnseenBytes()
+	u.removeKnown(s)
+	if u.count != 253 || !u.seen['a'] || !u.seen['b'] || !u.seen['c'] {
+		t.Errorf("%d bytes unseen after the ones of the model", u.count)
+	}
+	u.removeKnown(nil)
+	if u.count != 253 {
+		t.Errorf("%d bytes unseen after no model", u.count)
+	}
+}
+
+// BenchmarkUnseenLiterals codes every byte as a literal, in a scrambled order,
+// and reports the average size of the literals in bits.
+func BenchmarkUnseenLiterals(b *testing.B) {
+	order := make([]byte, 256)
+	for i := range order {
+		order[i] = byte(i * 167)
+	}
+	var total int
+	for range b.N {
+		u := newUnseenBytes()
+		total = 0
+		for _, c := range order {
+			total += int(truncatedBinaryLength(u.index(c), u.count))
+			u.remove(c)
+		}
+	}
+	b.ReportMetric(float64(total)/256, "bits/literal")
+}
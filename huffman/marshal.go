@@ -0,0 +1,471 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"huffman_coding/bits"
+	"sort"
+)
+
+var errCorruptTable = errors.New("huffman: corrupt code table")
+
+// Binary forms of a Codebook, told apart by the first byte.
+// MarshalBinary writes whichever is shorter.
+const (
+	// tableLengths stores the code lengths of bytes, Escape and End in symbolOrder,
+	// run-length coded and then Huffman coded the way DEFLATE stores its code lengths:
+	//
+	//	count   6 bits            number of code length code lengths stored
+	//	lengths count × 3 bits    code length code lengths in clcOrder
+	//	codes   the code lengths coded with the code length code, padded to a byte
+	tableLengths = iota
+	// tableList stores the symbols explicitly, which is shorter for small alphabets:
+	//
+	//	count   uvarint
+	//	symbols count × (uvarint key delta, 1 byte length) sorted by symbolKey
+	tableList
+)
+
+// Symbols of the code length code.
+// Code lengths themselves are symbols 0 to MaxCodeLength, the others are runs.
+const (
+	// repeat the previous length 3-6 times, 2 extra bits
+	clcRepeat = MaxCodeLength + 1 + iota
+	// repeat a zero length 3-10 times, 3 extra bits
+	clcZeros
+	// repeat a zero length 11-138 times, 7 extra bits
+	clcLongZeros
+	clcSymbols
+	// longest code of the code length code, so that its lengths fit 3 bits
+	clcMaxLength = 7
+)
+
+// clcOrder is the order code length code lengths are stored in,
+// the likely ones first so that the unused tail can be left out.
+var clcOrder = func() (order [clcSymbols]rune) {
+	i := 0
+	for _, s := range []rune{0, clcZeros, clcLongZeros, clcRepeat, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1} {
+		order[i] = s
+		i++
+	}
+	for s := rune(15); s <= MaxCodeLength; s++ {
+		order[i] = s
+		i++
+	}
+	return order
+}()
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+// Only the code lengths are stored, the canonical codes follow from them.
+func (c *Codebook) MarshalBinary() ([]byte, error) {
+	list := c.marshalList()
+	if lengths, ok := c.marshalLengths(); ok && len(lengths) < len(list) {
+		return lengths, nil
+	}
+	return list, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+// The code lengths are validated the same way NewCodebookLengths does.
+func (c *Codebook) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return errCorruptTable
+	}
+	var lengths map[rune]uint8
+	var err error
+	switch data[0] {
+	case tableLengths:
+		lengths, err = unmarshalLengths(data[1:])
+	case tableList:
+		lengths, err = unmarshalList(data[1:])
+	default:
+		err = fmt.Errorf("%w: unknown form %d", errCorruptTable, data[0])
+	}
+	if err != nil {
+		return err
+	}
+	cb, err := NewCodebookLengths(lengths)
+	if err != nil {
+		return err
+	}
+	*c = *cb
+	return nil
+}
+
+// symbolKey maps symbols to small numbers: bytes to themselves,
+// Escape and End to symbolOrder and any other rune after them.
+func symbolKey(char rune) uint64 {
+	if char >= 0 && char < 256 || char == Escape || char == End {
+		return uint64(symbolOrder(char))
+	}
+	return maxChars + uint64(uint32(char))
+}
+
+// keySymbol is the inverse of symbolKey.
+func keySymbol(key uint64) (rune, bool) {
+	switch {
+	case key < 256:
+		return rune(key), true
+	case key == uint64(symbolOrder(Escape)):
+		return Escape, true
+	case key == uint64(symbolOrder(End)):
+		return End, true
+	case key-maxChars <= 0xffffffff:
+		return rune(uint32(key - maxChars)), true
+	default:
+		return 0, false
+	}
+}
+
+func (c *Codebook) marshalList() []byte {
+	entries := append([]CodeEntry(nil), c.symbols...)
+	sort.Slice(entries, func(i, j int) bool { return symbolKey(entries[i].Char) < symbolKey(entries[j].Char) })
+
+	buf := []byte{tableList}
+	buf = binary.AppendUvarint(buf, uint64(len(entries)))
+	prev := uint64(0)
+	for _, e := range entries {
+		key := symbolKey(e.Char)
+		buf = binary.AppendUvarint(buf, key-prev)
+		buf = append(buf, e.Length)
+		prev = key
+	}
+	return buf
+}
+
+func unmarshalList(data []byte) (map[rune]uint8, error) {
+	r := bytes.NewReader(data)
+	count, err := binary.ReadUvarint(r)
+	if err != nil || count > uint64(len(data)) {
+		return nil, errCorruptTable
+	}
+	lengths := make(map[rune]uint8, count)
+	key := uint64(0)
+	for i := range count {
+		delta, err := binary.ReadUvarint(r)
+		if err != nil || (i > 0 && delta == 0) || key+delta < key {
+			return nil, errCorruptTable
+		}
+		key += delta
+		char, ok := keySymbol(key)
+		if _, dup := lengths[char]; !ok || dup {
+			return nil, errCorruptTable
+		}
+		if lengths[char], err = r.ReadByte(); err != nil {
+			return nil, errCorruptTable
+		}
+	}
+	if r.Len() != 0 {
+		return nil, errCorruptTable
+	}
+	return lengths, nil
+}
+
+// marshalLengths returns the tableLengths form,
+// ok is false if the codebook has symbols it can't store.
+func (c *Codebook) marshalLengths() (data []byte, ok bool) {
+	var lengths [maxChars]uint8
+	for _, e := range c.symbols {
+		key := symbolKey(e.Char)
+		if key >= maxChars {
+			return nil, false
+		}
+		lengths[key] = e.Length
+	}
+
+	// run-length code the lengths
+	type run struct {
+		sym   rune
+		extra uint64
+		bits  uint8
+	}
+	var runs []run
+	for i := 0; i < len(lengths); {
+		length := lengths[i]
+		n := 1
+		for i+n < len(lengths) && lengths[i+n] == length {
+			n++
+		}
+		i += n
+		switch {
+		case length == 0 && n >= 11:
+			if n > 138 {
+				// leave the rest for the next run
+				i -= n - 138
+				n = 138
+			}
+			runs = append(runs, run{clcLongZeros, uint64(n - 11), 7})
+			n = 0
+		case length == 0 && n >= 3:
+			runs = append(runs, run{clcZeros, uint64(n - 3), 3})
+			n = 0
+		default:
+			runs = append(runs, run{rune(length), 0, 0})
+			n--
+			for n >= 3 {
+				k := min(n, 6)
+				runs = append(runs, run{clcRepeat, uint64(k - 3), 2})
+				n -= k
+			}
+		}
+		// whatever is left is too short for a run
+		for ; n > 0; n-- {
+			runs = append(runs, run{rune(length), 0, 0})
+		}
+	}
+
+	// Huffman code the runs
+	counts := make([]uint64, clcSymbols)
+	for _, r := range runs {
+		counts[r.sym]++
+	}
+	chars := make([]rune, 0, clcSymbols)
+	used := make([]uint64, 0, clcSymbols)
+	for s, n := range counts {
+		if n > 0 {
+			chars = append(chars, rune(s))
+			used = append(used, n)
+		}
+	}
+	clc, err := newCodebookCounts(chars, used, clcMaxLength)
+	if err != nil {
+		return nil, false
+	}
+	stored := 0
+	for i, s := range clcOrder {
+		if _, length, ok := clc.Code(s); ok && length > 0 {
+			stored = i + 1
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(tableLengths)
+	bw := bits.NewWriter(&buf)
+	bw.WriteBits(uint64(stored), 6)
+	for _, s := range clcOrder[:stored] {
+		_, length, _ := clc.Code(s)
+		bw.WriteBits(uint64(length), 3)
+	}
+	for _, r := range runs {
+		code, length, _ := clc.Code(r.sym)
+		bw.WriteBits(code, length)
+		bw.WriteBits(r.extra, r.bits)
+	}
+	bw.Close()
+	return buf.Bytes(), true
+}
+
+func unmarshalLengths(data []byte) (map[rune]uint8, error) {
+	br := bits.NewReader(bytes.NewReader(data))
+	stored, err := readBits(br, 6)
+	if err != nil || stored > clcSymbols {
+		return nil, errCorruptTable
+	}
+	clcLengths := make(map[rune]uint8)
+	for _, s := range clcOrder[:stored] {
+		length, err := readBits(br, 3)
+		if err != nil {
+			return nil, errCorruptTable
+		}
+		if length > 0 {
+			clcLengths[s] = uint8(length)
+		}
+	}
+	clc, err := NewCodebookLengths(clcLengths)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorruptTable, err)
+	}
+
+	lengths := make(map[rune]uint8)
+	var prev uint8
+	for key := 0; key < maxChars; {
+		sym, err := clc.Decode(br)
+		if err != nil {
+			return nil, errCorruptTable
+		}
+		length, n := uint8(sym), 1
+		var extra uint64
+		switch sym {
+		case clcRepeat:
+			if key == 0 {
+				return nil, errCorruptTable
+			}
+			extra, err = readBits(br, 2)
+			length, n = prev, 3+int(extra)
+		case clcZeros:
+			extra, err = readBits(br, 3)
+			length, n = 0, 3+int(extra)
+		case clcLongZeros:
+			extra, err = readBits(br, 7)
+			length, n = 0, 11+int(extra)
+		}
+		if err != nil {
+			return nil, errCorruptTable
+		}
+		if key+n > maxChars {
+			return nil, errCorruptTable
+		}
+		for range n {
+			if length > 0 {
+				char, _ := keySymbol(uint64(key))
+				lengths[char] = length
+			}
+			key++
+		}
+		prev = length
+	}
+	return lengths, nil
+}
+
+// readBits reads n bits one by one and returns them as the lowest n bits of the result.
+func readBits(br *bits.Reader, n uint8) (uint64, error) {
+	var u uint64
+	for range n {
+		bit, err := br.ReadOneBit()
+		if err != nil {
+			return 0, err
+		}
+		u <<= 1
+		if bit {
+			u |= 1
+		}
+	}
+	return u, nil
+}
+
+// jsonCode is the JSON form of a CodeEntry.
+type jsonCode struct {
+	Symbol string `json:"symbol"`
+	Char   rune   `json:"char"`
+	Length uint8  `json:"length"`
+	Code   string `json:"code"`
+}
+
+// MarshalJSON implements json.Marshaler.
+// Codes are listed in canonical order, with printable symbol names for humans.
+func (c *Codebook) MarshalJSON() ([]byte, error) {
+	codes := make([]jsonCode, len(c.symbols))
+	for i, e := range c.symbols {
+		codes[i] = jsonCode{symbolName(e.Char), e.Char, e.Length, formatCode(e.Code, e.Length)}
+	}
+	return json.Marshal(struct {
+		Codes []jsonCode `json:"codes"`
+	}{codes})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+// Only chars and lengths are used, codes are recomputed and names ignored.
+func (c *Codebook) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Codes []jsonCode `json:"codes"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	lengths := make(map[rune]uint8, len(v.Codes))
+	for _, e := range v.Codes {
+		if _, ok := lengths[e.Char]; ok {
+			return fmt.Errorf("huffman: duplicate symbol %s", symbolName(e.Char))
+		}
+		lengths[e.Char] = e.Length
+	}
+	cb, err := NewCodebookLengths(lengths)
+	if err != nil {
+		return err
+	}
+	*c = *cb
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+// The subtree of n is stored in pre-order, one bit per node:
+// 0 for internal nodes, 1 for leaves followed by 9 bits of the leaf's symbolOrder.
+// Frequencies are not stored, and only bytes, Escape and End can be leaves.
+func (n *Node) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	bw := bits.NewWriter(&buf)
+
+	var traverse func(n *Node) error
+
+	traverse = func(n *Node) error {
+		if n.Left == nil {
+			// it's a leaf
+			key := symbolKey(n.Char)
+			if key >= maxChars {
+				return fmt.Errorf("huffman: can't store symbol %s in a tree", symbolName(n.Char))
+			}
+			return bw.WriteBits(1<<9|key, 10)
+		}
+		if err := bw.WriteOneBit(false); err != nil {
+			return err
+		}
+		if err := traverse(n.Left); err != nil {
+			return err
+		}
+		return traverse(n.Right)
+	}
+
+	if err := traverse(n); err != nil {
+		return nil, err
+	}
+	if err := bw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+// n becomes the root of the stored tree, with Parent links set and all frequencies 0.
+func (n *Node) UnmarshalBinary(data []byte) error {
+	br := bits.NewReader(bytes.NewReader(data))
+	seen := make(map[rune]bool)
+
+	var traverse func(depth int) (*Node, error)
+
+	traverse = func(depth int) (*Node, error) {
+		// a tree of maxChars leaves can't be deeper than that
+		if depth > maxChars {
+			return nil, errCorruptTable
+		}
+		leaf, err := br.ReadOneBit()
+		if err != nil {
+			return nil, errCorruptTable
+		}
+		if leaf {
+			key, err := readBits(br, 9)
+			if err != nil || key >= maxChars {
+				return nil, errCorruptTable
+			}
+			char, _ := keySymbol(key)
+			if seen[char] {
+				return nil, errCorruptTable
+			}
+			seen[char] = true
+			return &Node{Char: char}, nil
+		}
+		left, err := traverse(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		right, err := traverse(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		parent := &Node{Left: left, Right: right}
+		left.Parent, right.Parent = parent, parent
+		return parent, nil
+	}
+
+	root, err := traverse(0)
+	if err != nil {
+		return err
+	}
+	*n = *root
+	if n.Left != nil {
+		n.Left.Parent, n.Right.Parent = n, n
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// leafCodes returns the codes of the leaves of the subtree of n as strings of bits, by symbol.
+func leafCodes(n *Node) map[rune]string {
+	codes := make(map[rune]string)
+	var traverse func(n *Node, code string)
+	traverse = func(n *Node, code string) {
+		if n.Left == nil {
+			codes[n.Char] = code
+			return
+		}
+		traverse(n.Left, code+"0")
+		traverse(n.Right, code+"1")
+	}
+	traverse(n, "")
+	return codes
+}
+
+// testCodebooks returns codebooks stored in either binary form.
+func testCodebooks(t *testing.T) map[string]*Codebook {
+	t.Helper()
+	all := make(map[rune]uint64)
+	for i, b := range testData(10000) {
+		all[rune(b)]++
+		all[rune(i%256)]++
+	}
+	books := make(map[string]*Codebook)
+	for name, freqs := range map[string]map[rune]uint64{
+		"small": {'a': 5, 'b': 2, 'c': 1},
+		"bytes": all,
+		// runes beyond bytes can only be listed
+		"runes": {'a': 3, '世': 2, '界': 1, 0x10ffff: 1},
+	} {
+		c, err := NewCodebook(freqs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		books[name] = c
+	}
+	return books
+}
+
+func TestCodebookMarshalBinary(t *testing.T) {
+	forms := map[string]byte{"small": tableList, "bytes": tableLengths, "runes": tableList}
+	for name, c := range testCodebooks(t) {
+		data, err := c.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if data[0] != forms[name] {
+			t.Errorf("%s: stored in form %d, want %d", name, data[0], forms[name])
+		}
+		var got Codebook
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !equalCodes(codeStrings(&got), codeStrings(c)) {
+			t.Errorf("%s: codes changed by the round trip", name)
+		}
+
+		// both forms of codebooks which fit either are read back the same
+		if lengths, ok := c.marshalLengths(); ok {
+			for _, data := range [][]byte{lengths, c.marshalList()} {
+				var got Codebook
+				if err := got.UnmarshalBinary(data); err != nil || !equalCodes(codeStrings(&got), codeStrings(c)) {
+					t.Errorf("%s: form %d read back as %q, %v", name, data[0], codeStrings(&got), err)
+				}
+			}
+		}
+	}
+}
+
+func TestCodebookUnmarshalCorrupt(t *testing.T) {
+	var tables [][]byte
+	for _, c := range testCodebooks(t) {
+		if lengths, ok := c.marshalLengths(); ok {
+			tables = append(tables, lengths)
+		}
+		tables = append(tables, c.marshalList())
+	}
+	for _, data := range tables {
+		for n := range len(data) {
+			var c Codebook
+			if err := c.UnmarshalBinary(data[:n]); err == nil {
+				t.Errorf("form %d truncated to %d of %d bytes read without error", data[0], n, len(data))
+			}
+		}
+		// anything at all is either rejected or a valid codebook, and never panics
+		for i := 1; i < len(data)*8; i++ {
+			corrupt := bytes.Clone(data)
+			corrupt[i/8] ^= 1 << (i % 8)
+			var c Codebook
+			if c.UnmarshalBinary(corrupt) == nil {
+				if sum := kraftSum(&c); sum > 1 {
+					t.Errorf("form %d with bit %d flipped read as a codebook with Kraft sum %g", data[0], i, sum)
+				}
+			}
+		}
+	}
+
+	// over-subscribed codes stored in either form, as no valid codebook is
+	over := newCanonicalCodebook(map[rune]uint8{'a': 1, 'b': 1, 'c': 2})
+	lengths, _ := over.marshalLengths()
+	for _, data := range [][]byte{
+		lengths,
+		over.marshalList(),
+		{tableList, 2, 'a', 1, 0, 1},     // a listed twice
+		{tableList, 1, 'a', 1, 0},        // trailing byte
+		{tableList, 1, 'a', 0},           // zero length
+		{tableList, 1, 'a', 33},          // too long
+		{tableList, 0},                   // no symbols
+		{tableList, 0xff, 0xff, 0xff, 1}, // count larger than the table
+		{tableLengths},                   // no code length code
+		{7, 1, 2, 3},                     // unknown form
+		{},
+	} {
+		var c Codebook
+		if err := c.UnmarshalBinary(data); err == nil {
+			t.Errorf("%v read as codes %q, want an error", data, codeStrings(&c))
+		}
+	}
+}
+
+func TestCodebookJSON(t *testing.T) {
+	c, err := NewCodebookLengths(map[rune]uint8{'a': 1, 'b': 2, End: 3, Escape: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"codes":[` +
+		`{"symbol":"'a'","char":97,"length":1,"code":"0"},` +
+		`{"symbol":"'b'","char":98,"length":2,"code":"10"},` +
+		`{"symbol":"\u003ceof\u003e","char":2147483646,"length":3,"code":"110"},` +
+		`{"symbol":"\u003cnew\u003e","char":2147483647,"length":3,"code":"111"}]}`
+	if string(data) != want {
+		t.Errorf("got %s\nwant %s", data, want)
+	}
+	var got Codebook
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !equalCodes(codeStrings(&got), codeStrings(c)) {
+		t.Errorf("codes %q after the round trip, want %q", codeStrings(&got), codeStrings(c))
+	}
+
+	for _, data := range []string{
+		`{"codes":[{"char":97,"length":1},{"char":97,"length":1}]}`,
+		`{"codes":[{"char":97,"length":1},{"char":98,"length":1},{"char":99,"length":1}]}`,
+		`{"codes":[{"char":97,"length":0}]}`,
+		`{"codes":[]}`,
+		`{"codes":`,
+	} {
+		var c Codebook
+		if err := json.Unmarshal([]byte(data), &c); err == nil {
+			t.Errorf("%s read as codes %q, want an error", data, codeStrings(&c))
+		}
+	}
+}
+
+func TestNodeMarshalBinary(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{})
+	if _, err := w.Write([]byte("abracadabra, abracadabra!")); err != nil {
+		t.Fatal(err)
+	}
+	root := w.Root()
+	data, err := root.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Node
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !equalCodes(leafCodes(&got), leafCodes(root)) {
+		t.Errorf("leaves %q after the round trip, want %q", leafCodes(&got), leafCodes(root))
+	}
+	// every leaf can find its code through the Parent links
+	var check func(n *Node)
+	check = func(n *Node) {
+		if n.Left == nil {
+			if code, length := n.Code(); formatCode(code, length) != leafCodes(&got)[n.Char] {
+				t.Errorf("%s: Code() = %s", symbolName(n.Char), formatCode(code, length))
+			}
+			return
+		}
+		check(n.Left)
+		check(n.Right)
+	}
+	check(&got)
+
+	for n := range len(data) {
+		var got Node
+		if err := got.UnmarshalBinary(data[:n]); err == nil {
+			t.Errorf("tree truncated to %d of %d bytes read without error", n, len(data))
+		}
+	}
+	for _, tt := range []struct {
+		name string
+		bits string
+	}{
+		{"duplicate leaf", "0" + "1001100001" + "1001100001"},
+		{"symbol beyond End", "1" + "111111111"},
+		{"deep", strings.Repeat("0", 600)},
+	} {
+		var got Node
+		if err := got.UnmarshalBinary(packBits(tt.bits)); err == nil {
+			t.Errorf("%s: read as leaves %q, want an error", tt.name, leafCodes(&got))
+		}
+	}
+
+	if _, err := (&Node{Char: '世'}).MarshalBinary(); err == nil {
+		t.Error("tree with a leaf beyond bytes stored")
+	}
+}
+
+// packBits returns the string of 0s and 1s as bytes, padded with zeros.
+func packBits(s string) []byte {
+	data := make([]byte, (len(s)+7)/8)
+	for i, c := range s {
+		if c == '1' {
+			data[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return data
+}
@@ -0,0 +1,56 @@
+package huffman
+
+import (
+	"errors"
+	"huffman_coding/bits"
+)
+
+// Special symbols every Model has to be able to code besides bytes.
+const (
+	// Escape precedes a byte the model can't code, which is then written as an 8 bit literal.
+	Escape = newChar
+	// End marks the end of the data.
+	End = eof
+)
+
+// Model is the probability model behind the Huffman method.
+// It separates modeling from coding: Writer and Reader only ask the model
+// for codes and let it decode symbols, so adaptive, static, primed
+// or any domain specific models can be plugged in through Options.Model.
+//
+// Writer and Reader call the model in exactly the same order,
+// so a model updating itself deterministically stays in sync on both sides.
+// Models are not safe for concurrent use and must not be shared between streams.
+type Model interface {
+	// Code returns the code of char and its length in bits.
+	// ok is false if the model can't code char, which is then coded as Escape followed by the byte.
+	// Escape and End must always have a code.
+	Code(char rune) (code uint64, length uint8, ok bool)
+	// Decode reads the code of the next symbol from br and returns the symbol.
+	// It returns Escape for bytes which were coded as a literal, the literal is read by the caller.
+	Decode(br *bits.Reader) (char rune, err error)
+	// Update is called after char has been coded or decoded.
+	// It isn't called for Escape and End.
+	Update(char rune)
+}
+
+// NewAdaptiveModel returns the default model: an adaptive Huffman tree
+// which starts empty and learns the frequencies of bytes as they are coded.
+func NewAdaptiveModel() Model {
+	return newSymbols(false)
+}
+
+var errNoCode = errors.New("huffman: model has no code for a special symbol")
+
+// treeModel is implemented by models backed by a Huffman tree.
+type treeModel interface {
+	Root() *Node
+}
+
+// modelRoot returns the root of the Huffman tree of m, or nil if it doesn't have one.
+func modelRoot(m Model) *Node {
+	if t, ok := m.(treeModel); ok {
+		return t.Root()
+	}
+	return nil
+}
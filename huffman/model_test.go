@@ -0,0 +1,72 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"huffman_coding/bits"
+)
+
+// textCodebook returns a static codebook of the byte frequencies of text.
+func textCodebook(t *testing.T, text []byte) *Codebook {
+	t.Helper()
+	freqs := make(map[rune]uint64)
+	for _, b := range text {
+		freqs[rune(b)]++
+	}
+	c, err := NewCodebook(freqs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCodebookModel(t *testing.T) {
+	text := []byte("abracadabra, abracadabra! the quick brown fox jumps over the lazy dog")
+	c := textCodebook(t, text)
+	// bytes the codebook has no code for are escaped
+	data := append(bytes.Clone(text), "\x00Z\xff"...)
+	stream := compressed(t, Options{Model: c}, data[:10], data[10:])
+
+	got, err := io.ReadAll(NewReaderOptions(bytes.NewReader(stream), Options{Model: c}))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("got %q, %v, want %q", got, err, data)
+	}
+	// the static model codes its own text better than the adaptive one learning it
+	if adaptive := compressed(t, Options{}, text); len(compressed(t, Options{Model: c}, text)) >= len(adaptive) {
+		t.Errorf("codebook of the text doesn't compress it better than the adaptive model")
+	}
+
+	for _, method := range []Method{Range, RANS} {
+		w := NewWriterOptions(io.Discard, Options{Method: method, Model: c})
+		if _, err := w.Write(text); err == nil {
+			t.Errorf("%s: custom model accepted", method)
+		}
+	}
+}
+
+// notByteModel decodes 'a' as a symbol which isn't a byte.
+type notByteModel struct {
+	Model
+}
+
+func (m notByteModel) Decode(br *bits.Reader) (rune, error) {
+	char, err := m.Model.Decode(br)
+	if char == 'a' {
+		char = 'a' + 256
+	}
+	return char, err
+}
+
+func TestModelNotByte(t *testing.T) {
+	text := []byte("abracadabra")
+	c := textCodebook(t, text)
+	stream := compressed(t, Options{Model: c}, text)
+	got, err := io.ReadAll(NewReaderOptions(bytes.NewReader(stream), Options{Model: notByteModel{c}}))
+	var corrupt *CorruptInputError
+	if !errors.As(err, &corrupt) || !errors.Is(err, errNotByte) || len(got) != 0 {
+		t.Errorf("got %q, %v, want a *CorruptInputError", got, err)
+	}
+}
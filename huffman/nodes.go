@@ -1,4 +1,4 @@
-package main
+package huffman
 
 import (
 	"fmt"
@@ -9,6 +9,8 @@ type Node struct {
 	Parent, Left, Right *Node
 	Freq                int
 	Char                rune
+	// order breaks ties between nodes of equal frequency, see symbolOrder.
+	order int
 	// index of the item in the heap.
 	// It's needed by update method and is maintained by the heap.Interface methods.
 	index int
@@ -31,6 +33,19 @@ func (n *Node) Code() (r uint64, count uint8) {
 	return r, count
 }
 
+// symbolName returns a printable name of char.
+// Custom characters are given names in angle brackets.
+func symbolName(char rune) string {
+	switch char {
+	case newChar:
+		return "<new>"
+	case eof:
+		return "<eof>"
+	default:
+		return strconv.QuoteRune(char)
+	}
+}
+
 // Print traverses the Huffman tree and prints the values with their code in binary representation.
 // Function is used for debugging purposes.
 func Print(root *Node) {
@@ -58,8 +73,14 @@ func (h *NodeHeap) Len() int {
 	return len(*h)
 }
 
+// Less orders the nodes by frequency.
+// Ties are broken by Node.order, so no two nodes are ever equal.
 func (h *NodeHeap) Less(i, j int) bool {
-	return (*h)[i].Freq < (*h)[j].Freq
+	a, b := (*h)[i], (*h)[j]
+	if a.Freq != b.Freq {
+		return a.Freq < b.Freq
+	}
+	return a.order < b.order
 }
 
 func (h *NodeHeap) Swap(i, j int) {
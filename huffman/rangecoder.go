@@ -0,0 +1,292 @@
+package huffman
+
+import (
+	"errors"
+	"io"
+)
+
+// The range coder follows the one of LZMA:
+// a 32 bit range is narrowed down by every symbol and renormalized byte by byte,
+// carries are propagated through the cached byte and the following 0xff bytes.
+const (
+	rangeTop = 1 << 24
+	// maxTotalFreq keeps range/total above 2^8, so no symbol is ever given an empty range.
+	maxTotalFreq = 1 << 16
+	// rangeCodeLength is the number of bits of the start of a symbol's range,
+	// which trace events give as the code of symbols coded by the range coder.
+	rangeCodeLength = 16
+)
+
+var errRangeCorrupt = errors.New("huffman: corrupt range coded data")
+
+type rangeEncoder struct {
+	out       io.ByteWriter
+	low       uint64
+	rng       uint32
+	cache     byte
+	cacheSize int64
+	// number of bytes shifted out of low so far, written or pending
+	shifted int64
+}
+
+func newRangeEncoder(out io.ByteWriter) *rangeEncoder {
+	return &rangeEncoder{out: out, rng: 0xffffffff, cacheSize: 1}
+}
+
+// encode narrows the range down to [cum, cum+freq) out of total.
+func (e *rangeEncoder) encode(cum, freq, total uint32) error {
+	r := e.rng / total
+	e.low += uint64(r) * uint64(cum)
+	e.rng = r * freq
+	for e.rng < rangeTop {
+		e.rng <<= 8
+		if err := e.shiftLow(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shiftLow moves the top byte of low out, unless it could still change by a carry.
+func (e *rangeEncoder) shiftLow() error {
+	if uint32(e.low) < 0xff000000 || e.low >= 1<<32 {
+		carry := byte(e.low >> 32)
+		temp := e.cache
+		for {
+			if err := e.out.WriteByte(temp + carry); err != nil {
+				return err
+			}
+			temp = 0xff
+			if e.cacheSize--; e.cacheSize == 0 {
+				break
+			}
+		}
+		e.cache = byte(e.low >> 24)
+	}
+	e.cacheSize++
+	e.shifted++
+	e.low = (e.low & 0x00ffffff) << 8
+	return nil
+}
+
+// flush writes out everything needed to decode the symbols encoded so far.
+func (e *rangeEncoder) flush() error {
+	for range 5 {
+		if err := e.shiftLow(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type rangeDecoder struct {
+	in   io.ByteReader
+	code uint32
+	rng  uint32
+	// set once the first 5 bytes have been read
+	started bool
+	// number of bytes read after the first 5, the decoder always reads that far ahead of the encoder
+	read int64
+}
+
+func newRangeDecoder(in io.ByteReader) *rangeDecoder {
+	return &rangeDecoder{in: in, rng: 0xffffffff}
+}
+
+// start reads the bytes the encoder writes before the first symbol.
+func (d *rangeDecoder) start() error {
+	for range 5 {
+		b, err := d.in.ReadByte()
+		if err != nil {
+			return err
+		}
+		d.code = d.code<<8 | uint32(b)
+	}
+	d.started = true
+	return nil
+}
+
+// target returns the value out of total which identifies the next symbol.
+// It must be followed by decode with the symbol the value falls into.
+func (d *rangeDecoder) target(total uint32) (uint32, error) {
+	if !d.started {
+		if err := d.start(); err != nil {
+			return 0, err
+		}
+	}
+	d.rng /= total
+	value := d.code / d.rng
+	if value >= total {
+		return 0, errRangeCorrupt
+	}
+	return value, nil
+}
+
+// decode consumes the symbol at [cum, cum+freq).
+func (d *rangeDecoder) decode(cum, freq uint32) error {
+	d.code -= cum * d.rng
+	d.rng *= freq
+	for d.rng < rangeTop {
+		b, err := d.in.ReadByte()
+		if err != nil {
+			return err
+		}
+		d.code = d.code<<8 | uint32(b)
+		d.rng <<= 8
+		d.read++
+	}
+	return nil
+}
+
+// rangeFreqs returns the frequencies of the adaptive model in the fixed order of symbolOrder,
+// scaled down if needed so that their total fits maxTotalFreq.
+// Symbols not seen yet get 0, all the others at least 1.
+func (s *symbols) rangeFreqs(freqs *[maxChars]uint32) (total uint32) {
+	shift := 0
+	for (s.total>>shift)+maxChars > maxTotalFreq {
+		shift++
+	}
+	for i, freq := range s.freq[:maxChars] {
+		if freq == 0 {
+			freqs[i] = 0
+			continue
+		}
+		f := uint32(freq >> shift)
+		if f == 0 {
+			f = 1
+		}
+		freqs[i] = f
+		total += f
+	}
+	return total
+}
+
+// encodeRange encodes char with the range coder.
+// Characters not seen yet are encoded as newChar followed by the byte,
+// coded uniformly over the bytes not seen yet (or all of them without flagUnseenLiterals).
+func (w *Writer) encodeRange(char rune) error {
+	var freqs [maxChars]uint32
+	total := w.symbols.rangeFreqs(&freqs)
+
+	isNew := char != eof && w.symbols.leaf(char) < 0
+	sym := char
+	if isNew {
+		sym = newChar
+	}
+	order := symbolOrder(sym)
+	var cum uint32
+	for _, f := range freqs[:order] {
+		cum += f
+	}
+	offset := w.offset + 8*w.rc.shifted
+	if err := w.rc.encode(cum, freqs[order], total); err != nil {
+		return err
+	}
+	if isNew {
+		value, total := uint32(char), uint32(256)
+		if w.unseen != nil {
+			value, total = uint32(w.unseen.index(byte(char))), uint32(w.unseen.count)
+			w.unseen.remove(byte(char))
+		}
+		if err := w.rc.encode(value, 1, total); err != nil {
+			return err
+		}
+	}
+
+	if char != eof {
+		w.symbols.Update(char)
+	}
+	w.traceSymbol(w.symbols, offset, char, isNew, uint64(cum), rangeCodeLength)
+	return nil
+}
+
+// endRange encodes eof followed by a flag set if more follows the eof of a flush,
+// and writes the final bytes of the range coder.
+func (w *Writer) endRange(more bool) error {
+	if err := w.encodeRange(eof); err != nil {
+		return err
+	}
+	var flag uint32
+	if more {
+		flag = 1
+	}
+	if err := w.rc.encode(flag, 1, 2); err != nil {
+		return err
+	}
+	if err := w.rc.flush(); err != nil {
+		return err
+	}
+	w.offset += 8 * w.rc.shifted
+	return nil
+}
+
+// decodeRangeEnd decodes the flag following eof, see endRange.
+func (r *Reader) decodeRangeEnd() (more bool, err error) {
+	flag, err := r.rc.target(2)
+	if err != nil {
+		return false, err
+	}
+	if err = r.rc.decode(flag, 1); err != nil {
+		return false, err
+	}
+	// the encoder has flushed as many bytes as the decoder read ahead
+	r.offset += 8 * (r.rc.read + 5)
+	return flag == 1, nil
+}
+
+// decodeRange decodes the next character with the range coder.
+func (r *Reader) decodeRange() (rune, error) {
+	var freqs [maxChars]uint32
+	total := r.symbols.rangeFreqs(&freqs)
+
+	offset := r.offset + 8*r.rc.read
+	value, err := r.rc.target(total)
+	if err != nil {
+		return 0, err
+	}
+	var cum uint32
+	order := 0
+	for cum+freqs[order] <= value {
+		cum += freqs[order]
+		order++
+	}
+	if err = r.rc.decode(cum, freqs[order]); err != nil {
+		return 0, err
+	}
+
+	switch char := orderChar(order); char {
+	case newChar:
+		total := uint32(256)
+		if r.unseen != nil {
+			if total = uint32(r.unseen.count); total == 0 {
+				return 0, errNoUnseen
+			}
+		}
+		value, err := r.rc.target(total)
+		if err != nil {
+			return 0, err
+		}
+		if err = r.rc.decode(value, 1); err != nil {
+			return 0, err
+		}
+		char := rune(value)
+		if r.unseen != nil {
+			b, _ := r.unseen.byteAt(int(value))
+			r.unseen.remove(b)
+			char = rune(b)
+		}
+		if r.symbols.leaf(char) >= 0 {
+			return 0, errNoUnseen
+		}
+		r.symbols.insert(char)
+		r.traceSymbol(r.symbols, offset, char, true, uint64(cum), rangeCodeLength)
+		return char, nil
+	case eof:
+		r.traceSymbol(r.symbols, offset, eof, false, uint64(cum), rangeCodeLength)
+		return eof, nil
+	default:
+		r.symbols.update(order)
+		r.traceSymbol(r.symbols, offset, char, false, uint64(cum), rangeCodeLength)
+		return char, nil
+	}
+}
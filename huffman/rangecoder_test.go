@@ -0,0 +1,167 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// rangeSymbol is a symbol coded by the range coder, its range [cum, cum+freq) out of total.
+type rangeSymbol struct{ cum, freq, total uint32 }
+
+// rangeSymbols returns n symbols of the given distribution, picked by an LCG.
+func rangeSymbols(n int, freqs []uint32) []rangeSymbol {
+	var total uint32
+	for _, f := range freqs {
+		total += f
+	}
+	symbols := make([]rangeSymbol, n)
+	state := uint32(1)
+	for i := range symbols {
+		state = state*1664525 + 1013904223
+		value := uint32(uint64(state) * uint64(total) >> 32)
+		var cum uint32
+		j := 0
+		for cum+freqs[j] <= value {
+			cum += freqs[j]
+			j++
+		}
+		symbols[i] = rangeSymbol{cum, freqs[j], total}
+	}
+	return symbols
+}
+
+// rangeEncode returns the symbols range coded and the number of symbols which caused a carry.
+func rangeEncode(t *testing.T, symbols []rangeSymbol) (data []byte, carries int) {
+	t.Helper()
+	var buf bytes.Buffer
+	e := newRangeEncoder(&buf)
+	for _, s := range symbols {
+		if e.low+uint64(e.rng/s.total)*uint64(s.cum) >= 1<<32 {
+			carries++
+		}
+		if err := e.encode(s.cum, s.freq, s.total); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if e.shifted != int64(buf.Len()) {
+		t.Errorf("%d bytes shifted out, %d written", e.shifted, buf.Len())
+	}
+	return buf.Bytes(), carries
+}
+
+func TestRangeCoder(t *testing.T) {
+	uniform := make([]uint32, 256)
+	for i := range uniform {
+		uniform[i] = 1
+	}
+	skewed := append([]uint32{maxTotalFreq - 255}, uniform[1:]...)
+	for _, tt := range []struct {
+		name  string
+		freqs []uint32
+		// whether some symbols cause a carry
+		carries bool
+	}{
+		{"single", []uint32{1}, false},
+		{"few", []uint32{1, 1, 1, 1}, true},
+		{"uniform", uniform, true},
+		{"skewed", skewed, true},
+		// the narrowest range the coder is given
+		{"largest total", []uint32{maxTotalFreq - 1, 1}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			symbols := rangeSymbols(100000, tt.freqs)
+			data, carries := rangeEncode(t, symbols)
+			if tt.carries && carries == 0 {
+				t.Error("no carry has been propagated")
+			}
+
+			br := bytes.NewReader(data)
+			d := newRangeDecoder(br)
+			for i, s := range symbols {
+				value, err := d.target(s.total)
+				if err != nil {
+					t.Fatalf("symbol %d: %v", i, err)
+				}
+				if value < s.cum || value >= s.cum+s.freq {
+					t.Fatalf("symbol %d: decoded value %d, want [%d, %d)", i, value, s.cum, s.cum+s.freq)
+				}
+				if err := d.decode(s.cum, s.freq); err != nil {
+					t.Fatalf("symbol %d: %v", i, err)
+				}
+			}
+			// the decoder is as far as the encoder was before flushing
+			if read := int64(len(data)) - int64(br.Len()); read != d.read+5 {
+				t.Errorf("read %d bytes, counted %d after the first 5", read, d.read)
+			}
+		})
+	}
+}
+
+func TestRangeDecoderCorrupt(t *testing.T) {
+	// a code beyond the range of any symbol
+	d := newRangeDecoder(bytes.NewReader([]byte{0, 0xff, 0xff, 0xff, 0xff}))
+	if _, err := d.target(3); err != errRangeCorrupt {
+		t.Errorf("target of an impossible code: %v, want %v", err, errRangeCorrupt)
+	}
+
+	// truncated data
+	symbols := rangeSymbols(1000, []uint32{5, 1, 1, 1})
+	data, _ := rangeEncode(t, symbols)
+	for _, n := range []int{0, 4, len(data) / 2} {
+		d := newRangeDecoder(bytes.NewReader(data[:n]))
+		var err error
+		for _, s := range symbols {
+			if _, err = d.target(s.total); err != nil {
+				break
+			}
+			if err = d.decode(s.cum, s.freq); err != nil {
+				break
+			}
+		}
+		if !errors.Is(err, io.EOF) {
+			t.Errorf("truncated to %d of %d bytes: %v, want io.EOF", n, len(data), err)
+		}
+	}
+}
+
+func BenchmarkRangeCoder(b *testing.B) {
+	freqs := make([]uint32, 64)
+	for i := range freqs {
+		freqs[i] = uint32(i + 1)
+	}
+	symbols := rangeSymbols(1<<16, freqs)
+	var buf bytes.Buffer
+	e := newRangeEncoder(&buf)
+	for _, s := range symbols {
+		e.encode(s.cum, s.freq, s.total)
+	}
+	e.flush()
+	data := bytes.Clone(buf.Bytes())
+
+	b.Run("encode", func(b *testing.B) {
+		b.SetBytes(int64(len(symbols)))
+		for range b.N {
+			buf.Reset()
+			e := newRangeEncoder(&buf)
+			for _, s := range symbols {
+				e.encode(s.cum, s.freq, s.total)
+			}
+			e.flush()
+		}
+	})
+	b.Run("decode", func(b *testing.B) {
+		b.SetBytes(int64(len(symbols)))
+		for range b.N {
+			d := newRangeDecoder(bytes.NewReader(data))
+			for _, s := range symbols {
+				d.target(s.total)
+				d.decode(s.cum, s.freq)
+			}
+		}
+	})
+}
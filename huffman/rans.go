@@ -0,0 +1,264 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+)
+
+// The RANS method splits the data into blocks and codes every block
+// with a static frequency table, using two interleaved rANS states
+// with byte-wise renormalization. A block is stored as:
+//
+//	length    uvarint  number of bytes in the block, 0 ends the stream
+//	present   32 bytes bitmap of the bytes occurring in the block
+//	freqs     uvarint  normalized frequency of every present byte, in byte order
+//	size      uvarint  number of bytes of the coded data
+//	states    8 bytes  final encoder states, big endian
+//	data      size-8 bytes of renormalization output, in decoding order
+const (
+	ransBlockSize = 1 << 16
+	ransScaleBits = 12
+	ransScale     = 1 << ransScaleBits
+	// lower bound of the normalized state interval [ransLow, ransLow<<8)
+	ransLow = 1 << 23
+)
+
+var errRANSCorrupt = errors.New("huffman: corrupt rANS coded data")
+
+// normalizeFreqs scales counts so that they add up to ransScale,
+// keeping every present byte at a frequency of at least 1.
+func normalizeFreqs(counts *[256]int, total int) (freqs [256]uint32) {
+	sum := 0
+	largest := 0
+	for b, c := range counts {
+		if c == 0 {
+			continue
+		}
+		f := int(uint64(c) * ransScale / uint64(total))
+		if f == 0 {
+			f = 1
+		}
+		freqs[b] = uint32(f)
+		sum += f
+		if freqs[b] > freqs[largest] {
+			largest = b
+		}
+	}
+
+	if sum <= ransScale {
+		// rounding down left some space, give it to the most frequent byte
+		freqs[largest] += uint32(ransScale - sum)
+		return freqs
+	}
+
+	// bytes bumped up to 1 took too much, take it back from the most frequent ones
+	order := make([]int, 0, 256)
+	for b, f := range freqs {
+		if f > 1 {
+			order = append(order, b)
+		}
+	}
+	sort.Slice(order, func(i, j int) bool {
+		if freqs[order[i]] != freqs[order[j]] {
+			return freqs[order[i]] > freqs[order[j]]
+		}
+		return order[i] < order[j]
+	})
+	for excess := sum - ransScale; excess > 0; {
+		for _, b := range order {
+			if excess == 0 {
+				break
+			}
+			if freqs[b] > 1 {
+				freqs[b]--
+				excess--
+			}
+		}
+	}
+	return freqs
+}
+
+// writeRANSBlock codes block and writes it to w.
+func writeRANSBlock(w io.Writer, block []byte) error {
+	var counts [256]int
+	for _, b := range block {
+		counts[b]++
+	}
+	freqs := normalizeFreqs(&counts, len(block))
+	var cums [256]uint32
+	var cum uint32
+	for b, f := range freqs {
+		cums[b] = cum
+		cum += f
+	}
+
+	// rANS works as a stack, so the block is coded backwards
+	// and the output is reversed at the end
+	out := make([]byte, 0, len(block)+8)
+	states := [2]uint32{ransLow, ransLow}
+	for i := len(block) - 1; i >= 0; i-- {
+		x := &states[i&1]
+		b := block[i]
+		f := freqs[b]
+		for limit := uint32(ransLow>>ransScaleBits<<8) * f; *x >= limit; *x >>= 8 {
+			out = append(out, byte(*x))
+		}
+		*x = (*x/f)<<ransScaleBits + *x%f + cums[b]
+	}
+	for i := 1; i >= 0; i-- {
+		x := states[i]
+		out = append(out, byte(x), byte(x>>8), byte(x>>16), byte(x>>24))
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+
+	buf := make([]byte, 0, 2*binary.MaxVarintLen64+32+2*256)
+	buf = binary.AppendUvarint(buf, uint64(len(block)))
+	var present [32]byte
+	for b, f := range freqs {
+		if f > 0 {
+			present[b/8] |= 1 << (b % 8)
+		}
+	}
+	buf = append(buf, present[:]...)
+	for _, f := range freqs {
+		if f > 0 {
+			buf = binary.AppendUvarint(buf, uint64(f))
+		}
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(out)))
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+	_, err := w.Write(out)
+	return err
+}
+
+// writeRANSEnd writes the empty block ending the stream.
+func writeRANSEnd(w io.ByteWriter) error {
+	return w.WriteByte(0)
+}
+
+// ransByteReader is what readRANSBlock needs from the bit stream.
+type ransByteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// readRANSBlock reads and decodes the next block into buf, which is reused if big enough.
+// Returns io.EOF at the empty block ending the stream, io.ErrUnexpectedEOF if the input ends before it.
+func readRANSBlock(r ransByteReader, buf []byte) ([]byte, error) {
+	length, err := readRANSUvarint(r)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	if length == 0 {
+		return nil, io.EOF
+	}
+	if length > ransBlockSize {
+		return nil, errRANSCorrupt
+	}
+
+	var present [32]byte
+	if _, err = io.ReadFull(r, present[:]); err != nil {
+		return nil, noEOF(err)
+	}
+	var freqs, cums [256]uint32
+	var cum uint32
+	for b := range freqs {
+		if present[b/8]&(1<<(b%8)) == 0 {
+			continue
+		}
+		f, err := readRANSUvarint(r)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		if f == 0 || f > ransScale {
+			return nil, errRANSCorrupt
+		}
+		freqs[b], cums[b] = uint32(f), cum
+		cum += uint32(f)
+	}
+	if cum != ransScale {
+		return nil, errRANSCorrupt
+	}
+	// slot to byte lookup table
+	var symbols [ransScale]byte
+	for b, f := range freqs {
+		for i := range f {
+			symbols[cums[b]+i] = byte(b)
+		}
+	}
+
+	size, err := readRANSUvarint(r)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	if size < 8 || size > 2*ransBlockSize+8 {
+		return nil, errRANSCorrupt
+	}
+	in := make([]byte, size)
+	if _, err = io.ReadFull(r, in); err != nil {
+		return nil, noEOF(err)
+	}
+
+	states := [2]uint32{binary.BigEndian.Uint32(in), binary.BigEndian.Uint32(in[4:])}
+	in = in[8:]
+	if cap(buf) < int(length) {
+		buf = make([]byte, length)
+	}
+	buf = buf[:length]
+	for i := range buf {
+		x := &states[i&1]
+		slot := *x & (ransScale - 1)
+		b := symbols[slot]
+		buf[i] = b
+		*x = freqs[b]*(*x>>ransScaleBits) + slot - cums[b]
+		for *x < ransLow {
+			if len(in) == 0 {
+				return nil, errRANSCorrupt
+			}
+			*x = *x<<8 | uint32(in[0])
+			in = in[1:]
+		}
+	}
+	if len(in) != 0 || states != [2]uint32{ransLow, ransLow} {
+		return nil, errRANSCorrupt
+	}
+	return buf, nil
+}
+
+// readRANSUvarint reads a uvarint like binary.ReadUvarint,
+// but reports values overflowing 64 bits as errRANSCorrupt.
+func readRANSUvarint(r io.ByteReader) (uint64, error) {
+	var x uint64
+	for i := range binary.MaxVarintLen64 {
+		b, err := r.ReadByte()
+		if err == io.EOF && i > 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		if i == binary.MaxVarintLen64-1 && b > 1 {
+			return 0, errRANSCorrupt
+		}
+		if b < 0x80 {
+			return x | uint64(b)<<(7*i), nil
+		}
+		x |= uint64(b&0x7f) << (7 * i)
+	}
+	return 0, errRANSCorrupt
+}
+
+// noEOF turns io.EOF into io.ErrUnexpectedEOF,
+// since only the empty block may end a stream.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,166 @@
+package huffman
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestNormalizeFreqs(t *testing.T) {
+	var dominant [256]int
+	for b := range dominant {
+		dominant[b] = 1
+	}
+	dominant['a'] = 1 << 20
+	for _, tt := range []struct {
+		name   string
+		counts [256]int
+	}{
+		{"single", [256]int{'a': 7}},
+		{"two", [256]int{'a': 1, 'b': 2}},
+		{"uniform", func() (c [256]int) {
+			for b := range c {
+				c[b] = 3
+			}
+			return c
+		}()},
+		// the rare bytes are bumped up to 1 and take the excess from 'a'
+		{"dominant", dominant},
+		{"rounding", [256]int{'a': 1, 'b': 1, 'c': 1}},
+	} {
+		total := 0
+		for _, c := range tt.counts {
+			total += c
+		}
+		freqs := normalizeFreqs(&tt.counts, total)
+		sum := 0
+		for b, f := range freqs {
+			if (f == 0) != (tt.counts[b] == 0) {
+				t.Errorf("%s: byte %d counted %d times has frequency %d", tt.name, b, tt.counts[b], f)
+			}
+			sum += int(f)
+		}
+		if sum != ransScale {
+			t.Errorf("%s: frequencies add up to %d, want %d", tt.name, sum, ransScale)
+		}
+	}
+}
+
+// ransBlock returns block coded by writeRANSBlock.
+func ransBlock(t *testing.T, block []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := writeRANSBlock(&buf, block); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRANSBlock(t *testing.T) {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	for _, tt := range []struct {
+		name  string
+		block []byte
+	}{
+		{"one", []byte{'x'}},
+		{"two", []byte("xy")},
+		{"repeated", bytes.Repeat([]byte{'x'}, 1000)},
+		{"bytes", all},
+		{"text", testData(10000)},
+		{"largest", testData(ransBlockSize)},
+	} {
+		data := ransBlock(t, tt.block)
+		// the buffer is reused if it's big enough
+		buf := make([]byte, 0, ransBlockSize)
+		r := bufio.NewReader(bytes.NewReader(data))
+		got, err := readRANSBlock(r, buf)
+		if err != nil || !bytes.Equal(got, tt.block) {
+			t.Errorf("%s: read back as %d bytes, %v", tt.name, len(got), err)
+			continue
+		}
+		if &got[0] != &buf[:1][0] {
+			t.Errorf("%s: buffer not reused", tt.name)
+		}
+		if _, err := r.ReadByte(); err != io.EOF {
+			t.Errorf("%s: block not read to its end", tt.name)
+		}
+	}
+
+	var end bytes.Buffer
+	writeRANSEnd(&end)
+	if _, err := readRANSBlock(bufio.NewReader(&end), nil); err != io.EOF {
+		t.Errorf("end of the stream read as %v, want io.EOF", err)
+	}
+}
+
+func TestRANSBlockCorrupt(t *testing.T) {
+	block := testData(1000)
+	data := ransBlock(t, block)
+	for n := range len(data) {
+		_, err := readRANSBlock(bufio.NewReader(bytes.NewReader(data[:n])), nil)
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("truncated to %d of %d bytes: %v, want io.ErrUnexpectedEOF", n, len(data), err)
+		}
+	}
+	// no change goes unnoticed but the ones of the coded data, which decodes to other bytes
+	for i := range len(data) {
+		corrupt := bytes.Clone(data)
+		corrupt[i] ^= 0x10
+		got, err := readRANSBlock(bufio.NewReader(bytes.NewReader(corrupt)), nil)
+		if err == nil && bytes.Equal(got, block) {
+			t.Errorf("byte %d changed read as the block", i)
+		}
+	}
+
+	var present [32]byte
+	present[0] = 1
+	header := append([]byte{10}, present[:]...)
+	// 10 zeros, the states never change when a single byte takes the whole scale
+	zeros := append(bytes.Clone(header), 0x80, 0x20, 8, 0, 0x80, 0, 0, 0, 0x80, 0, 0)
+	if got, err := readRANSBlock(bufio.NewReader(bytes.NewReader(zeros)), nil); err != nil || !bytes.Equal(got, make([]byte, 10)) {
+		t.Fatalf("crafted block read as %v, %v", got, err)
+	}
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"too long", []byte{0x81, 0x80, 0x04}},
+		{"uvarint overflow", bytes.Repeat([]byte{0xff}, 10)},
+		{"frequency 0", append(bytes.Clone(header), 0)},
+		{"frequencies below the scale", append(bytes.Clone(header), 0x80, 0x10, 8, 0, 0, 0, 0, 0, 0, 0, 0)},
+		{"no states", append(bytes.Clone(header), 0x80, 0x20, 7, 0, 0, 0, 0, 0, 0, 0)},
+		{"wrong final states", append(bytes.Clone(header), 0x80, 0x20, 8, 0, 0x80, 0, 1, 0, 0x80, 0, 0)},
+	} {
+		_, err := readRANSBlock(bufio.NewReader(bytes.NewReader(tt.data)), nil)
+		if !errors.Is(err, errRANSCorrupt) {
+			t.Errorf("%s: %v, want %v", tt.name, err, errRANSCorrupt)
+		}
+	}
+}
+
+func BenchmarkRANSBlock(b *testing.B) {
+	block := testData(ransBlockSize)
+	var buf bytes.Buffer
+	writeRANSBlock(&buf, block)
+	data := bytes.Clone(buf.Bytes())
+
+	b.Run("write", func(b *testing.B) {
+		b.SetBytes(int64(len(block)))
+		for range b.N {
+			buf.Reset()
+			writeRANSBlock(&buf, block)
+		}
+	})
+	b.Run("read", func(b *testing.B) {
+		b.SetBytes(int64(len(block)))
+		out := make([]byte, ransBlockSize)
+		for range b.N {
+			readRANSBlock(bufio.NewReader(bytes.NewReader(data)), out)
+		}
+	})
+}
@@ -0,0 +1,455 @@
+package huffman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"huffman_coding/bits"
+	"io"
+)
+
+var (
+	// errFlushPoint is returned internally by Reader.next where the Writer was flushed.
+	errFlushPoint = errors.New("huffman: flush point")
+	// errEnd is returned internally by Reader.decode at the end of the stream,
+	// io.EOF from the input is never expected by it.
+	errEnd  = errors.New("huffman: end of stream")
+	errSize = errors.New("huffman: data doesn't have the size recorded in the header")
+	// errNotByte is returned when a Model decodes a symbol which is neither a byte nor special.
+	errNotByte = errors.New("huffman: model decoded a symbol which isn't a byte")
+	// ErrLimitExceeded is returned by Readers decompressing more data than Options.MaxSize
+	// or Options.MaxRatio allow.
+	ErrLimitExceeded = errors.New("huffman: decompression limit exceeded")
+)
+
+// CorruptInputError is returned by Readers decoding data which can't have been written by a Writer.
+// Offset is the number of compressed bytes read when the corruption was detected,
+// the corrupt data is somewhere before it.
+type CorruptInputError struct {
+	Offset int64
+	// Err describes the corruption
+	Err error
+}
+
+func (e *CorruptInputError) Error() string {
+	return fmt.Sprintf("%v before offset %d", e.Err, e.Offset)
+}
+
+func (e *CorruptInputError) Unwrap() error {
+	return e.Err
+}
+
+// corrupt reports whether err means the input is corrupt.
+func corrupt(err error) bool {
+	switch err {
+	case errRangeCorrupt, errRANSCorrupt, errNoUnseen, ErrInvalidCode, errSize, errNotByte:
+		return true
+	}
+	return false
+}
+
+// ratioAllowance is the number of bytes decompressed without checking Options.MaxRatio.
+const ratioAllowance = 1 << 20
+
+// Reader is the Huffman reader implementation.
+// Input ending before the end of the stream is reported as io.ErrUnexpectedEOF
+// and input a Writer can't have written as a *CorruptInputError.
+// Every read after an error fails the same, errors of the input included:
+// a read failing in the middle of a code, like one timing out, leaves nothing to resume from.
+// Whatever the input, reading never panics and uses a bounded amount of memory.
+type Reader struct {
+	tracer
+	// options given to the constructor, the model is picked once the method is known
+	opts Options
+	// model decodes the symbols of the Huffman method
+	model Model
+	// adaptive model of the Range method and the default model of the Huffman method
+	symbols *symbols
+	br      *bits.Reader
+	header  header
+	// set once the header has been read
+	started bool
+	// range coder, only used by the Range method
+	rc *rangeDecoder
+	// decoded block and the position of the next byte in it, only used by the RANS method
+	block []byte
+	pos   int
+	// bytes not read as literals yet, nil unless flagUnseenLiterals is set
+	unseen *unseenBytes
+	// number of bits read so far
+	offset int64
+	// number of bytes decoded so far
+	decoded int64
+	// the compressed input, only counted with Options.MaxRatio
+	input *countingReader
+	// returned by every read once the stream has ended or anything has failed
+	err error
+	// chunks copied by WriteTo and DecompressContext, allocated on first use
+	buf []byte
+}
+
+// NewReader returns a Reader decoding in with the default options.
+// The coding method is taken from the header of the stream.
+func NewReader(in io.Reader) *Reader {
+	return NewReaderOptions(in, Options{})
+}
+
+// NewReaderOptions returns a Reader decoding in, configured by opts.
+// The coding method is taken from the header of the stream.
+func NewReaderOptions(in io.Reader, opts Options) *Reader {
+	r := &Reader{opts: opts}
+	if opts.MaxRatio > 0 {
+		r.input = &countingReader{r: in}
+		in = r.input
+	}
+	r.br = bits.NewReader(in)
+	return r
+}
+
+// start reads the header before the first symbol.
+func (r *Reader) start() error {
+	if r.started {
+		return nil
+	}
+	if r.err != nil {
+		// the header has been refused already
+		return r.err
+	}
+	if err := r.header.read(r.br); err != nil {
+		r.err = err
+		return err
+	}
+	var err error
+	if r.symbols, r.model, err = newModel(r.header, r.opts.Model, r.opts.Dictionary); err != nil {
+		r.err = err
+		return err
+	}
+	if r.header.flags&flagUnseenLiterals != 0 {
+		r.unseen = newUnseenBytes()
+		r.unseen.removeKnown(r.symbols)
+	}
+	if r.header.method == Range {
+		r.rc = newRangeDecoder(r.br)
+	}
+	r.started = true
+	return nil
+}
+
+// Method returns the method the stream is coded with.
+// The header is read if it hasn't been yet.
+func (r *Reader) Method() (Method, error) {
+	err := r.start()
+	return r.header.method, err
+}
+
+// Size returns the size of the uncompressed data recorded in the header,
+// or -1 if it hasn't been recorded. The header is read if it hasn't been yet.
+func (r *Reader) Size() (int64, error) {
+	if err := r.start(); err != nil {
+		return -1, err
+	}
+	if r.header.flags&flagSize == 0 {
+		return -1, nil
+	}
+	return int64(r.header.size), nil
+}
+
+// Read decompresses up to len(p) bytes from the source.
+// It returns early at the points where the Writer was flushed,
+// instead of waiting for more input.
+// An error ending the stream, like io.EOF, is returned by the call after the last data,
+// and by every following one.
+func (r *Reader) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		if r.pos < len(r.block) && r.err == nil {
+			if k := r.readBlock(p[n:]); k > 0 {
+				n += k
+				r.err = r.checkLimits()
+				continue
+			}
+		}
+		b, err := r.next()
+		switch {
+		case err == errFlushPoint:
+			if n > 0 {
+				return n, nil
+			}
+		case err != nil:
+			if n > 0 && r.err != nil {
+				// r.err is returned by the next call
+				return n, nil
+			}
+			return n, err
+		default:
+			p[n] = b
+			n++
+		}
+	}
+	return n, nil
+}
+
+// readBlock copies the rest of the current RANS block to p, as far as available allows.
+func (r *Reader) readBlock(p []byte) int {
+	k := r.available(len(p))
+	copy(p, r.block[r.pos:r.pos+k])
+	r.pos += k
+	r.decoded += int64(k)
+	return k
+}
+
+// available returns how much of the rest of the current RANS block, up to n bytes,
+// the size in the header and Options.MaxSize allow to be read.
+// Decoding the next byte reports an error if they don't allow any more.
+func (r *Reader) available(n int) int {
+	k := int64(min(n, len(r.block)-r.pos))
+	if r.header.flags&flagSize != 0 {
+		k = min(k, int64(r.header.size)-r.decoded)
+	}
+	if r.opts.MaxSize > 0 {
+		k = min(k, r.opts.MaxSize-r.decoded)
+	}
+	return int(max(k, 0))
+}
+
+// WriteTo implements io.WriterTo, decompressing everything to w.
+// The decompressed data is written in chunks, and whenever a flush point is reached.
+// The RANS method writes its blocks to w as they are decoded.
+func (r *Reader) WriteTo(w io.Writer) (n int64, err error) {
+	if err := r.start(); err != nil {
+		return 0, err
+	}
+	if r.header.method != RANS {
+		return copyContext(context.Background(), w, r, r.chunk())
+	}
+	for r.err == nil {
+		switch err := r.fillBlock(); {
+		case err == errFlushPoint:
+		case err != nil:
+			r.check(err)
+		case r.available(len(r.block)) == 0:
+			// let next report why nothing more may be read
+			r.next()
+		default:
+			m, err := w.Write(r.block[r.pos : r.pos+r.available(len(r.block))])
+			r.pos += m
+			r.decoded += int64(m)
+			n += int64(m)
+			if err != nil {
+				return n, err
+			}
+			r.err = r.checkLimits()
+		}
+	}
+	if r.err == io.EOF {
+		return n, nil
+	}
+	return n, r.err
+}
+
+// chunk returns the buffer of chunkSize bytes WriteTo and DecompressContext copy through.
+func (r *Reader) chunk() []byte {
+	if r.buf == nil {
+		r.buf = make([]byte, chunkSize)
+	}
+	return r.buf
+}
+
+// ReadByte decompresses a single byte
+func (r *Reader) ReadByte() (b byte, err error) {
+	for {
+		if b, err = r.next(); err != errFlushPoint {
+			return b, err
+		}
+	}
+}
+
+// next decompresses a single byte, or returns errFlushPoint
+// where the Writer was flushed, with the input ready for the data following the flush.
+// The size recorded in the header is checked at the end.
+// Input ending before the end of the stream is reported as io.ErrUnexpectedEOF,
+// corrupt input as a *CorruptInputError.
+func (r *Reader) next() (b byte, err error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	b, err = r.decode()
+	if err == nil {
+		r.decoded++
+		if r.header.flags&flagSize != 0 && uint64(r.decoded) > r.header.size {
+			err = errSize
+		} else {
+			err = r.checkLimits()
+		}
+	}
+	return b, r.check(err)
+}
+
+// check turns an error of decoding into the one reported to the caller,
+// and keeps it in r.err, since nothing more can be decoded after any of them.
+func (r *Reader) check(err error) error {
+	switch {
+	case err == errEnd:
+		err = io.EOF
+		if r.header.flags&flagSize != 0 && uint64(r.decoded) != r.header.size {
+			err = errSize
+		}
+	case err == io.EOF:
+		err = io.ErrUnexpectedEOF
+	}
+	// anything following the end of the stream isn't decoded,
+	// and after an error the input may have been left in the middle of a code
+	// and the model half updated, nothing sensible can be decoded anymore
+	switch {
+	case err == nil || err == errFlushPoint:
+	case corrupt(err):
+		err = &CorruptInputError{Offset: r.br.Offset(), Err: err}
+		r.err = err
+	default:
+		r.err = err
+	}
+	return err
+}
+
+// checkLimits returns ErrLimitExceeded if more has been decoded than the options allow.
+func (r *Reader) checkLimits() error {
+	if r.opts.MaxSize > 0 && r.decoded > r.opts.MaxSize {
+		return fmt.Errorf("%w: more than %d bytes", ErrLimitExceeded, r.opts.MaxSize)
+	}
+	if r.input != nil && r.decoded > ratioAllowance &&
+		float64(r.decoded) > r.opts.MaxRatio*float64(r.input.n) {
+		return fmt.Errorf("%w: more than %g times the %d compressed bytes", ErrLimitExceeded, r.opts.MaxRatio, r.input.n)
+	}
+	return nil
+}
+
+// decode is next without checking the size.
+func (r *Reader) decode() (b byte, err error) {
+	if err = r.start(); err != nil {
+		return 0, err
+	}
+	switch r.header.method {
+	case RANS:
+		if err = r.fillBlock(); err != nil {
+			return 0, err
+		}
+		b = r.block[r.pos]
+		r.pos++
+		return b, nil
+	case Range:
+		char, err := r.decodeRange()
+		if err != nil {
+			return 0, err
+		}
+		if char == eof {
+			// the stream ends here unless the Writer was flushed, then a new range coder starts
+			more, err := r.decodeRangeEnd()
+			if err != nil {
+				return 0, err
+			}
+			if !more {
+				return 0, errEnd
+			}
+			r.rc = newRangeDecoder(r.br)
+			return 0, errFlushPoint
+		}
+		return byte(char), nil
+	}
+
+	char, err := r.model.Decode(r.br)
+	if err != nil {
+		return 0, err
+	}
+	isNew := char == Escape
+	offset := r.offset
+	var code uint64
+	var count uint8
+	if r.tracing() {
+		// the code has to be looked up before the model changes
+		code, count, _ = r.model.Code(char)
+		r.offset += int64(count)
+	}
+
+	switch char {
+	case Escape:
+		if b, err = r.readLiteral(); err != nil {
+			return 0, err
+		}
+		char = rune(b)
+		if _, _, known := r.model.Code(char); known {
+			// known bytes are never escaped
+			return 0, errNoUnseen
+		}
+	case End:
+		// the stream ends here unless the Writer was flushed, then the next bit is set and padding follows
+		r.traceSymbol(r.model, offset, End, false, code, count)
+		more, err := r.br.ReadOneBit()
+		if err != nil {
+			return 0, err
+		}
+		if !more {
+			return 0, errEnd
+		}
+		r.offset += 1 + int64(r.br.Align())
+		return 0, errFlushPoint
+	default:
+		// custom models can decode anything, a Writer only codes bytes
+		if char < 0 || char > 255 {
+			return 0, errNotByte
+		}
+	}
+	r.model.Update(char)
+	r.traceSymbol(r.model, offset, char, isNew, code, count)
+	return byte(char), nil
+}
+
+// fillBlock makes sure the current RANS block has bytes left, decoding the next one if needed.
+// It returns errFlushPoint at the end of every block, and errEnd at the end of the stream.
+func (r *Reader) fillBlock() error {
+	if r.pos == len(r.block) && r.pos > 0 {
+		// blocks are flushed as a whole, so the next one may not have been written yet
+		r.block, r.pos = r.block[:0], 0
+		return errFlushPoint
+	}
+	for r.pos == len(r.block) {
+		var err error
+		if r.block, err = readRANSBlock(r.br, r.block); err == io.EOF {
+			return errEnd
+		} else if err != nil {
+			return err
+		}
+		r.pos = 0
+	}
+	return nil
+}
+
+// readLiteral reads an escaped byte.
+func (r *Reader) readLiteral() (byte, error) {
+	if r.unseen == nil {
+		r.offset += 8
+		return r.br.ReadByte()
+	}
+	if r.unseen.count == 0 {
+		return 0, errNoUnseen
+	}
+	i, err := readTruncatedBinary(r.br, r.unseen.count)
+	if err != nil {
+		return 0, err
+	}
+	b, ok := r.unseen.byteAt(i)
+	if !ok {
+		return 0, errNoUnseen
+	}
+	r.offset += int64(truncatedBinaryLength(i, r.unseen.count))
+	r.unseen.remove(b)
+	return b, nil
+}
+
+// Root returns the root of the current Huffman tree of the model,
+// or nil if the model isn't backed by a tree or the header hasn't been read yet.
+// The adaptive model returns a copy of its tree, which isn't updated by the following reads.
+func (r *Reader) Root() *Node {
+	if r.model == nil {
+		return nil
+	}
+	return modelRoot(r.model)
+}
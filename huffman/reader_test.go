@@ -0,0 +1,290 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+var methods = []Method{Huffman, Range, RANS}
+
+// compressed returns the chunks compressed with opts, flushing the Writer after each but the last.
+func compressed(tb testing.TB, opts Options, chunks ...[]byte) []byte {
+	tb.Helper()
+	var buf bytes.Buffer
+	w := NewWriterOptions(&buf, opts)
+	for i, chunk := range chunks {
+		if _, err := w.Write(chunk); err != nil {
+			tb.Fatal(err)
+		}
+		if i < len(chunks)-1 {
+			if err := w.Flush(); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// fuzzDictionary is given to the Readers of FuzzReader, so that the seeds using it can be decoded.
+var fuzzDictionary = Train([][]byte{[]byte("the quick brown fox jumps over the lazy dog")})
+
+func FuzzReader(f *testing.F) {
+	text := []byte("abracadabra, abracadabra! the quick brown fox jumps over the lazy dog")
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	for _, method := range methods {
+		f.Add(compressed(f, Options{Method: method}))
+		f.Add(compressed(f, Options{Method: method}, text))
+		f.Add(compressed(f, Options{Method: method}, text[:20], text[20:], all))
+		f.Add(compressed(f, Options{Method: method, Size: int64(len(text))}, text))
+		f.Add(compressed(f, Options{Method: method, Preseed: true}, all, text))
+		f.Add(compressed(f, Options{Method: method, Dictionary: fuzzDictionary}, text))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := NewReaderOptions(bytes.NewReader(data), Options{Dictionary: fuzzDictionary})
+		_, err := io.Copy(io.Discard, r)
+		var corrupt *CorruptInputError
+		switch {
+		case err == nil, err == io.ErrUnexpectedEOF, errors.As(err, &corrupt), errors.Is(err, ErrHeader):
+		case errors.Is(err, ErrDictionary):
+			// the header asks for another dictionary than fuzzDictionary
+		default:
+			t.Fatalf("unexpected error %v", err)
+		}
+		// errors are sticky
+		if err != nil {
+			if _, again := r.Read(make([]byte, 1)); again == nil || again.Error() != err.Error() {
+				t.Fatalf("read after %v returned %v", err, again)
+			}
+		}
+	})
+}
+
+func TestReaderTruncated(t *testing.T) {
+	text := []byte("abracadabra, abracadabra! the quick brown fox jumps over the lazy dog")
+	for _, method := range methods {
+		t.Run(method.String(), func(t *testing.T) {
+			data := compressed(t, Options{Method: method}, text[:10], text[10:30], text[30:])
+			for n := range len(data) {
+				_, err := io.ReadAll(NewReader(bytes.NewReader(data[:n])))
+				if err != io.ErrUnexpectedEOF && !errors.Is(err, ErrHeader) {
+					t.Errorf("%d of %d bytes: error = %v, want io.ErrUnexpectedEOF", n, len(data), err)
+				}
+			}
+			got, err := io.ReadAll(NewReader(bytes.NewReader(data)))
+			if err != nil || !bytes.Equal(got, text) {
+				t.Errorf("whole stream: got %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestReaderFlush(t *testing.T) {
+	for _, method := range methods {
+		t.Run(method.String(), func(t *testing.T) {
+			chunks := []string{"hello", " world"}
+			pr, pw := io.Pipe()
+			w := NewWriterOptions(pw, Options{Method: method})
+			r := NewReader(pr)
+			// the writer waits for every chunk to be read, which blocks forever unless Flush sent all of it
+			read := make(chan struct{})
+			closed := make(chan error, 1)
+			go func() {
+				closed <- func() error {
+					for _, chunk := range chunks {
+						if _, err := w.Write([]byte(chunk)); err != nil {
+							return err
+						}
+						// flushing again right away is harmless
+						for range 2 {
+							if err := w.Flush(); err != nil {
+								pw.CloseWithError(err)
+								return err
+							}
+						}
+						<-read
+					}
+					return w.Close()
+				}()
+			}()
+			for _, want := range chunks {
+				got := make([]byte, len(want))
+				if _, err := io.ReadFull(r, got); err != nil || string(got) != want {
+					t.Fatalf("got %q, %v, want %q", got, err, want)
+				}
+				read <- struct{}{}
+			}
+			if _, err := r.Read(make([]byte, 1)); err != io.EOF {
+				t.Errorf("read after the last chunk: %v, want io.EOF", err)
+			}
+			if err := <-closed; err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestReadEOF(t *testing.T) {
+	text := []byte("abracadabra, abracadabra! the quick brown fox jumps over the lazy dog")
+	for _, method := range methods {
+		for _, opts := range []Options{{Method: method}, {Method: method, Size: int64(len(text))}} {
+			r := NewReader(bytes.NewReader(compressed(t, opts, text)))
+			buf := make([]byte, 2*len(text))
+			n, err := r.Read(buf)
+			if n != len(text) || err != nil {
+				t.Errorf("%s: first Read = %d, %v, want %d, nil", method, n, err, len(text))
+			}
+			if n, err = r.Read(buf); n != 0 || err != io.EOF {
+				t.Errorf("%s: second Read = %d, %v, want 0, io.EOF", method, n, err)
+			}
+		}
+	}
+}
+
+// testData returns n bytes of skewed pseudo-random text.
+func testData(n int) []byte {
+	data := make([]byte, n)
+	state := uint32(1)
+	for i := range data {
+		state = state*1664525 + 1013904223
+		data[i] = 'a' + byte(state>>28) + byte(state>>24&0xf)
+	}
+	return data
+}
+
+// plainWriter and plainReader hide the io.ReaderFrom and io.WriterTo implementations from io.Copy.
+type (
+	plainWriter struct{ io.Writer }
+	plainReader struct{ io.Reader }
+)
+
+func TestCopyFastPaths(t *testing.T) {
+	// more than a few RANS blocks, which don't line up with the buffers of io.Copy
+	data := testData(3*ransBlockSize + 1234)
+	for _, method := range methods {
+		for _, opts := range []Options{
+			{Method: method},
+			{Method: method, Size: int64(len(data))},
+			{Method: method, MaxSize: int64(len(data))},
+		} {
+			var fast, plain bytes.Buffer
+			w := NewWriterOptions(&fast, opts)
+			// odd sized reads, and no WriteTo for io.Copy to call instead of Writer.ReadFrom
+			if _, err := io.Copy(w, iotest.HalfReader(bytes.NewReader(data))); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			w = NewWriterOptions(&plain, opts)
+			if _, err := io.Copy(plainWriter{w}, plainReader{bytes.NewReader(data)}); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(fast.Bytes(), plain.Bytes()) {
+				t.Fatalf("%s: Writer.ReadFrom and Writer.Write compress differently", method)
+			}
+
+			var fastOut, plainOut bytes.Buffer
+			n, err := io.Copy(&fastOut, NewReaderOptions(bytes.NewReader(fast.Bytes()), opts))
+			if err != nil || n != int64(len(data)) {
+				t.Fatalf("%s: Reader.WriteTo = %d, %v", method, n, err)
+			}
+			r := NewReaderOptions(bytes.NewReader(plain.Bytes()), opts)
+			if _, err := io.Copy(plainWriter{&plainOut}, plainReader{r}); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(fastOut.Bytes(), data) || !bytes.Equal(plainOut.Bytes(), data) {
+				t.Errorf("%s: Reader.WriteTo or Reader.Read decompress wrong data", method)
+			}
+		}
+	}
+}
+
+func TestWriteToAfterRead(t *testing.T) {
+	data := testData(2*ransBlockSize + 10)
+	for _, method := range methods {
+		r := NewReader(bytes.NewReader(compressed(t, Options{Method: method}, data)))
+		head := make([]byte, 1000)
+		if _, err := io.ReadFull(r, head); err != nil {
+			t.Fatal(err)
+		}
+		var rest bytes.Buffer
+		if _, err := r.WriteTo(&rest); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(append(head, rest.Bytes()...), data) {
+			t.Errorf("%s: Read followed by WriteTo decompress wrong data", method)
+		}
+	}
+}
+
+// benchmarkInputs are compressed by the benchmarks of every method.
+var benchmarkInputs = []struct {
+	name string
+	data func() []byte
+}{
+	{"text", func() []byte { return testData(1 << 16) }},
+	// every byte equally likely, nothing to compress
+	{"random", func() []byte {
+		data := make([]byte, 1<<16)
+		state := uint32(1)
+		for i := range data {
+			state = state*1664525 + 1013904223
+			data[i] = byte(state >> 24)
+		}
+		return data
+	}},
+}
+
+// BenchmarkWrite measures the compression speed of every method,
+// and reports the compressed size in percent of the input as "%size".
+func BenchmarkWrite(b *testing.B) {
+	for _, input := range benchmarkInputs {
+		data := input.data()
+		for _, method := range methods {
+			b.Run(input.name+"/"+method.String(), func(b *testing.B) {
+				b.SetBytes(int64(len(data)))
+				b.ReportAllocs()
+				var buf bytes.Buffer
+				for range b.N {
+					buf.Reset()
+					w := NewWriterOptions(&buf, Options{Method: method})
+					w.Write(data)
+					w.Close()
+				}
+				b.ReportMetric(100*float64(buf.Len())/float64(len(data)), "%size")
+			})
+		}
+	}
+}
+
+// BenchmarkRead measures the decompression speed of every method.
+func BenchmarkRead(b *testing.B) {
+	for _, input := range benchmarkInputs {
+		data := input.data()
+		for _, method := range methods {
+			b.Run(input.name+"/"+method.String(), func(b *testing.B) {
+				src := compressed(b, Options{Method: method}, data)
+				b.SetBytes(int64(len(data)))
+				b.ReportAllocs()
+				for range b.N {
+					if _, err := io.Copy(io.Discard, NewReader(bytes.NewReader(src))); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
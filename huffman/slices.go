@@ -0,0 +1,88 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+)
+
+var errTrailingData = errors.New("huffman: data after the end of the stream")
+
+// AppendDecompress allocates the size recorded in the header up front, but that size may be corrupt,
+// so at most maxPrealloc bytes and preallocRatio times the compressed size.
+// The Huffman method takes at least a bit per byte, the others compress more only on very repetitive data.
+// Bigger outputs grow while decoding.
+const (
+	maxPrealloc   = 64 << 20
+	preallocRatio = 8
+)
+
+// Compress returns src compressed with the default options.
+// Like all the functions on slices it's safe for concurrent use,
+// every call coding with a model of its own.
+func Compress(src []byte) []byte {
+	return AppendCompress(nil, src)
+}
+
+// AppendCompress appends src compressed with the default options to dst and returns the extended slice.
+// The size of src is recorded in the header, so that decompressing allocates the output at once.
+func AppendCompress(dst, src []byte) []byte {
+	buf := bytes.NewBuffer(dst)
+	w := NewWriterOptions(buf, Options{Size: int64(len(src))})
+	// writing to a bytes.Buffer can't fail
+	w.Write(src)
+	w.Close()
+	return buf.Bytes()
+}
+
+// Decompress returns the data decompressed from src, which must hold a single stream.
+func Decompress(src []byte) ([]byte, error) {
+	return AppendDecompress(nil, src)
+}
+
+// AppendDecompress appends the data decompressed from src, which must hold a single stream,
+// to dst and returns the extended slice.
+// Data following the end of the stream is reported as a *CorruptInputError.
+// On error the data decompressed until then is appended.
+func AppendDecompress(dst, src []byte) ([]byte, error) {
+	in := bytes.NewReader(src)
+	r := NewReader(in)
+	size, err := r.Size()
+	if err != nil {
+		return dst, err
+	}
+	start := len(dst)
+	if size >= 0 {
+		dst = slices.Grow(dst, int(min(size, maxPrealloc, preallocRatio*int64(len(src)))))
+	}
+	for {
+		if len(dst) == cap(dst) {
+			if int64(len(dst)-start) == size {
+				// everything has been decoded, only the end of the stream is left
+				if _, err := r.ReadByte(); err != io.EOF {
+					return dst, err
+				}
+				return dst, trailingData(in)
+			}
+			dst = append(dst, 0)[:len(dst)]
+		}
+		n, err := r.Read(dst[len(dst):cap(dst)])
+		dst = dst[:len(dst)+n]
+		if err == io.EOF {
+			return dst, trailingData(in)
+		}
+		if err != nil {
+			return dst, err
+		}
+	}
+}
+
+// trailingData returns an error if anything follows the stream read from in.
+// Readers read nothing past the end of the stream from an io.ByteReader.
+func trailingData(in *bytes.Reader) error {
+	if in.Len() == 0 {
+		return nil
+	}
+	return &CorruptInputError{Offset: in.Size() - int64(in.Len()), Err: errTrailingData}
+}
@@ -0,0 +1,122 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestCompressSlices(t *testing.T) {
+	for _, data := range [][]byte{nil, {0}, []byte("abracadabra"), testData(3*ransBlockSize + 5)} {
+		compressed := Compress(data)
+		got, err := Decompress(compressed)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%d bytes: Decompress = %d bytes, %v", len(data), len(got), err)
+		}
+		if size, err := NewReader(bytes.NewReader(compressed)).Size(); len(data) > 0 && (err != nil || size != int64(len(data))) {
+			t.Errorf("%d bytes: recorded size %d, %v", len(data), size, err)
+		}
+	}
+}
+
+func TestAppendSlices(t *testing.T) {
+	data := []byte("abracadabra")
+	prefix := []byte("prefix")
+
+	compressed := AppendCompress(bytes.Clone(prefix), data)
+	if !bytes.HasPrefix(compressed, prefix) || !bytes.Equal(compressed[len(prefix):], Compress(data)) {
+		t.Fatalf("AppendCompress = %q, want the prefix followed by the stream", compressed)
+	}
+	got, err := AppendDecompress(bytes.Clone(prefix), compressed[len(prefix):])
+	if err != nil || string(got) != "prefixabracadabra" {
+		t.Errorf("AppendDecompress = %q, %v", got, err)
+	}
+
+	// the spare capacity of dst is used, and what follows it isn't overwritten
+	buf := make([]byte, 0, 64)
+	buf = append(buf, prefix...)
+	after := buf[len(prefix)+len(data) : cap(buf)]
+	after[0] = '!'
+	got, err = AppendDecompress(buf, compressed[len(prefix):])
+	if err != nil || string(got) != "prefixabracadabra" || &got[0] != &buf[:1][0] {
+		t.Errorf("AppendDecompress into spare capacity = %q, %v", got, err)
+	}
+	if after[0] != '!' {
+		t.Errorf("AppendDecompress wrote past the decompressed data")
+	}
+}
+
+func TestDecompressTrailingData(t *testing.T) {
+	data := []byte("abracadabra")
+	for _, method := range methods {
+		// with and without the size, which end decoding in different places
+		for _, opts := range []Options{{Method: method}, {Method: method, Size: int64(len(data))}} {
+			src := compressed(t, opts, data)
+			if got, err := Decompress(src); err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("%s: Decompress = %q, %v", method, got, err)
+			}
+			for _, trailing := range [][]byte{{0}, []byte("junk"), src} {
+				got, err := Decompress(append(bytes.Clone(src), trailing...))
+				var corrupt *CorruptInputError
+				if !errors.As(err, &corrupt) || corrupt.Err != errTrailingData || corrupt.Offset != int64(len(src)) {
+					t.Errorf("%s, size %d: %d trailing bytes: %v, want %v at offset %d",
+						method, opts.Size, len(trailing), err, errTrailingData, len(src))
+				}
+				if !bytes.Equal(got, data) {
+					t.Errorf("%s, size %d: %d trailing bytes: decompressed %q", method, opts.Size, len(trailing), got)
+				}
+			}
+		}
+	}
+}
+
+func TestDecompressForgedSize(t *testing.T) {
+	// a header claiming 1 TiB, without any coded data
+	src := append([]byte(magic), formatVersion, byte(Huffman), flagUnseenLiterals|flagSize)
+	src = binary.AppendUvarint(src, 1<<40)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	got, err := Decompress(src)
+	runtime.ReadMemStats(&after)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("Decompress error = %v, want io.ErrUnexpectedEOF", err)
+	}
+	// rounded up to the size class of the allocation
+	if cap(got) > 2*preallocRatio*len(src) {
+		t.Errorf("Decompress allocated %d bytes for %d bytes of input", cap(got), len(src))
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("Decompress allocated %d bytes in total", allocated)
+	}
+}
+
+func TestSlicesConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data := testData(10<<10 + i)
+			for range 5 {
+				got, err := Decompress(Compress(data))
+				if err != nil || !bytes.Equal(got, data) {
+					errs <- fmt.Errorf("goroutine %d: round trip returned %d bytes, %v", i, len(got), err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
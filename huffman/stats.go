@@ -0,0 +1,167 @@
+package huffman
+
+import (
+	"io"
+	"math"
+	"sort"
+)
+
+// Stats describes how well the adaptive Huffman code fits some data.
+// Code lengths and codes are the ones of the model after all the data has been seen.
+type Stats struct {
+	Method       Method `json:"method"`
+	Uncompressed int64  `json:"uncompressed"`
+	Compressed   int64  `json:"compressed"`
+	// Entropy is the Shannon entropy of the byte frequencies in bits per byte.
+	Entropy float64 `json:"entropy"`
+	// AverageLength is the average code length of the final code in bits per byte.
+	AverageLength float64 `json:"averageLength"`
+	// Redundancy is how much longer the average code is than the entropy in bits per byte.
+	Redundancy float64 `json:"redundancy"`
+	// BitsPerByte is the achieved compression rate including escapes and model adaptation.
+	BitsPerByte float64       `json:"bitsPerByte"`
+	Symbols     []SymbolStats `json:"symbols"`
+}
+
+// SymbolStats describes a single symbol of the code.
+type SymbolStats struct {
+	Char   rune   `json:"char"`
+	Freq   int    `json:"freq"`
+	Length uint8  `json:"length"`
+	Code   string `json:"code"`
+}
+
+// Name returns a printable name of the symbol.
+// Custom characters are given names in angle brackets.
+func (s SymbolStats) Name() string {
+	return symbolName(s.Char)
+}
+
+// Analyze compresses the data read from r and returns the statistics of the result.
+// The compressed data is discarded.
+func Analyze(r io.Reader) (*Stats, error) {
+	return AnalyzeOptions(r, Options{})
+}
+
+// AnalyzeOptions is like Analyze, compressing with the given options.
+func AnalyzeOptions(r io.Reader, opts Options) (*Stats, error) {
+	cr := &countingReader{r: r}
+	cw := &countingWriter{w: io.Discard}
+	w := NewWriterOptions(cw, opts)
+	if _, err := io.Copy(w, cr); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	st := w.symbols.stats(cr.n, cw.n)
+	st.Method = w.header.method
+	return st, nil
+}
+
+// AnalyzeCompressed decompresses the data read from r and returns the statistics of it.
+// The decompressed data is discarded.
+func AnalyzeCompressed(r io.Reader) (*Stats, error) {
+	return AnalyzeCompressedOptions(r, Options{})
+}
+
+// AnalyzeCompressedOptions is like AnalyzeCompressed, decompressing with the given options.
+// Untrusted data should be analyzed with MaxSize or MaxRatio set.
+func AnalyzeCompressedOptions(r io.Reader, opts Options) (*Stats, error) {
+	cr := &countingReader{r: r}
+	cw := &countingWriter{w: io.Discard}
+	hr := NewReaderOptions(cr, opts)
+	if _, err := io.Copy(cw, hr); err != nil {
+		return nil, err
+	}
+	st := hr.symbols.stats(cw.n, cr.n)
+	st.Method = hr.header.method
+	return st, nil
+}
+
+// stats returns the statistics of the adaptive model s.
+// A nil s, as with custom models, gives only the sizes.
+func (s *symbols) stats(uncompressed, compressed int64) *Stats {
+	st := &Stats{
+		Uncompressed: uncompressed,
+		Compressed:   compressed,
+	}
+	if uncompressed > 0 {
+		st.BitsPerByte = 8 * float64(compressed) / float64(uncompressed)
+	}
+	if s == nil {
+		return st
+	}
+	leaves := s.leaves[:s.nleaves]
+	st.Symbols = make([]SymbolStats, 0, len(leaves))
+
+	total := 0
+	for _, leaf := range leaves {
+		if leaf < 256 {
+			total += s.freq[leaf]
+		}
+	}
+
+	for _, leaf := range leaves {
+		char, freq := orderChar(int(leaf)), s.freq[leaf]
+		code, length, _ := s.Code(char)
+		st.Symbols = append(st.Symbols, SymbolStats{
+			Char:   char,
+			Freq:   freq,
+			Length: length,
+			Code:   formatCode(code, length),
+		})
+		if leaf >= 256 || total == 0 {
+			continue
+		}
+		p := float64(freq) / float64(total)
+		st.Entropy -= p * math.Log2(p)
+		st.AverageLength += p * float64(length)
+	}
+	st.Redundancy = st.AverageLength - st.Entropy
+
+	// most frequent first
+	sort.Slice(st.Symbols, func(i, j int) bool {
+		a, b := st.Symbols[i], st.Symbols[j]
+		if a.Freq != b.Freq {
+			return a.Freq > b.Freq
+		}
+		return a.Char < b.Char
+	})
+	return st
+}
+
+// formatCode returns the count lowest bits of code as a string of 0s and 1s.
+func formatCode(code uint64, count uint8) string {
+	b := make([]byte, count)
+	for i := range b {
+		if code&(1<<(int(count)-1-i)) != 0 {
+			b[i] = '1'
+		} else {
+			b[i] = '0'
+		}
+	}
+	return string(b)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,89 @@
+package huffman
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	const text = "abracadabra"
+	st, err := Analyze(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := compressed(t, Options{}, []byte(text))
+	if st.Method != Huffman || st.Uncompressed != int64(len(text)) || st.Compressed != int64(len(data)) {
+		t.Errorf("method %v, sizes %d and %d, want %v, %d and %d",
+			st.Method, st.Uncompressed, st.Compressed, Huffman, len(text), len(data))
+	}
+
+	// most frequent first, ties by char
+	want := []SymbolStats{
+		{'a', 5, 1, "0"},
+		{'b', 2, 3, "100"},
+		{'r', 2, 3, "101"},
+		{'c', 1, 4, "1100"},
+		{'d', 1, 4, "1101"},
+		{eof, 1, 4, "1111"},
+		{newChar, 1, 4, "1110"},
+	}
+	if !reflect.DeepEqual(st.Symbols, want) {
+		t.Errorf("symbols\n%v\nwant\n%v", st.Symbols, want)
+	}
+
+	// only the bytes count, not eof and newChar
+	entropy := -(5.0/11*math.Log2(5.0/11) + 2*2.0/11*math.Log2(2.0/11) + 2*1.0/11*math.Log2(1.0/11))
+	for _, f := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"entropy", st.Entropy, entropy},
+		{"average length", st.AverageLength, 25.0 / 11},
+		{"redundancy", st.Redundancy, 25.0/11 - entropy},
+		{"bits per byte", st.BitsPerByte, 8 * float64(len(data)) / 11},
+	} {
+		if math.Abs(f.got-f.want) > 1e-9 {
+			t.Errorf("%s %g, want %g", f.name, f.got, f.want)
+		}
+	}
+
+	// the Reader ends with the same model
+	got, err := AnalyzeCompressed(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, st) {
+		t.Errorf("stats of the compressed data\n%+v\nwant\n%+v", got, st)
+	}
+}
+
+func TestAnalyzeEmpty(t *testing.T) {
+	st, err := Analyze(strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Uncompressed != 0 || st.Compressed == 0 || st.Entropy != 0 || st.AverageLength != 0 || st.BitsPerByte != 0 {
+		t.Errorf("stats of no data %+v", st)
+	}
+	for _, s := range st.Symbols {
+		if s.Char < 256 {
+			t.Errorf("symbol %s without data", s.Name())
+		}
+	}
+}
+
+func TestAnalyzeModel(t *testing.T) {
+	// custom models give only the sizes
+	text := []byte("abracadabra")
+	opts := Options{Model: textCodebook(t, text)}
+	st, err := AnalyzeOptions(bytes.NewReader(text), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Uncompressed != int64(len(text)) || st.Compressed == 0 || st.Symbols != nil {
+		t.Errorf("stats with a custom model %+v", st)
+	}
+}
@@ -0,0 +1,260 @@
+package huffman
+
+import (
+	"slices"
+
+	"huffman_coding/bits"
+)
+
+const (
+	newChar     rune                = 1<<31 - 1 - iota // value representing a new character
+	eof                                                // value representing end of data
+	customChars = iota                                 // number of custom characters
+	maxChars    = 256 + customChars                    // number of possible bytes + custom characters
+	// maxNodes is the number of nodes of a tree of all the possible characters
+	maxNodes = 2*maxChars - 1
+)
+
+// symbols is the adaptive model, whose Huffman tree is rebuilt after every symbol.
+// The tree is stored in flat arrays indexed by node, so rebuilding it allocates nothing:
+// leaves are indexed by symbolOrder and internal nodes follow them in the order of their creation,
+// which is also the order breaking ties between nodes of the same frequency.
+type symbols struct {
+	// frequency of every node, 0 for the leaves of characters not seen yet
+	freq [maxNodes]int
+	// children of the internal nodes, indexed by node - maxChars
+	left, right [maxChars - 1]int16
+	root        int16
+	// leaves of the tree sorted by frequency and order, and the position of every leaf in it
+	leaves  [maxChars]int16
+	nleaves int
+	pos     [maxChars]int16
+	// codes of the leaves, computed from the tree when needed
+	codes      [maxChars]leafCode
+	codesValid bool
+	// sum of the frequencies of all leaves
+	total int
+}
+
+type leafCode struct {
+	code   uint64
+	length uint8
+}
+
+// newSymbols returns the adaptive model knowing only the custom characters,
+// or every byte as well if preseed is set.
+func newSymbols(preseed bool) *symbols {
+	return newSymbolsFreqs(nil, preseed)
+}
+
+// newSymbolsFreqs returns the adaptive model primed with the given byte frequencies,
+// knowing the bytes with a positive frequency and the custom characters.
+// With preseed every byte gets 1 added to its frequency. A nil freqs primes nothing.
+func newSymbolsFreqs(freqs *[256]int, preseed bool) *symbols {
+	s := new(symbols)
+	s.freq[symbolOrder(newChar)] = 1
+	s.freq[symbolOrder(eof)] = 1
+	for char := range 256 {
+		if freqs != nil {
+			s.freq[char] = freqs[char]
+		}
+		if preseed {
+			s.freq[char]++
+		}
+	}
+
+	for leaf, freq := range s.freq[:maxChars] {
+		if freq > 0 {
+			s.leaves[s.nleaves] = int16(leaf)
+			s.nleaves++
+			s.total += freq
+		}
+	}
+	leaves := s.leaves[:s.nleaves]
+	slices.SortFunc(leaves, func(a, b int16) int {
+		if s.less(a, b) {
+			return -1
+		}
+		return 1
+	})
+	for i, leaf := range leaves {
+		s.pos[leaf] = int16(i)
+	}
+
+	s.buildTree()
+
+	return s
+}
+
+// Root returns the current Huffman tree as linked Nodes, built anew by every call.
+func (s *symbols) Root() *Node {
+	var nodes [maxNodes]*Node
+	for _, leaf := range s.leaves[:s.nleaves] {
+		nodes[leaf] = &Node{Freq: s.freq[leaf], Char: orderChar(int(leaf)), order: int(leaf)}
+	}
+	for i := range s.nleaves - 1 {
+		left, right := nodes[s.left[i]], nodes[s.right[i]]
+		parent := &Node{Left: left, Right: right, Freq: s.freq[maxChars+i], order: maxChars + i}
+		left.Parent, right.Parent = parent, parent
+		nodes[maxChars+i] = parent
+	}
+	return nodes[s.root]
+}
+
+// Code implements Model.
+// Characters which haven't been seen yet have no code.
+func (s *symbols) Code(char rune) (code uint64, length uint8, ok bool) {
+	leaf := s.leaf(char)
+	if leaf < 0 {
+		return 0, 0, false
+	}
+	if !s.codesValid {
+		s.computeCodes()
+	}
+	c := s.codes[leaf]
+	return c.code, c.length, true
+}
+
+// Decode implements Model by walking the tree from the root, bit by bit.
+func (s *symbols) Decode(br *bits.Reader) (char rune, err error) {
+	node := s.root
+	for node >= maxChars { // read until we reach a leaf
+		var right bool
+		if right, err = br.ReadOneBit(); err != nil {
+			return 0, err
+		}
+		if right {
+			node = s.right[node-maxChars]
+		} else {
+			node = s.left[node-maxChars]
+		}
+	}
+	return orderChar(int(node)), nil
+}
+
+// Update implements Model.
+// Characters seen the first time are added to the tree.
+func (s *symbols) Update(char rune) {
+	if leaf := s.leaf(char); leaf >= 0 {
+		s.update(leaf)
+	} else {
+		s.insert(char)
+	}
+}
+
+// symbolOrder returns the tie-breaking order of the leaf holding char.
+// Bytes are ordered by their value, followed by newChar and eof.
+// Internal nodes come after all the leaves, see buildTree.
+func symbolOrder(char rune) int {
+	switch char {
+	case newChar:
+		return 256
+	case eof:
+		return 257
+	default:
+		return int(char)
+	}
+}
+
+// orderChar returns the character of the leaf with the given order, the inverse of symbolOrder.
+func orderChar(order int) rune {
+	switch order {
+	case 256:
+		return newChar
+	case 257:
+		return eof
+	default:
+		return rune(order)
+	}
+}
+
+// leaf returns the leaf of char, or -1 if char isn't in the tree.
+func (s *symbols) leaf(char rune) int {
+	if (char < 0 || char > 255) && char != newChar && char != eof {
+		return -1
+	}
+	if leaf := symbolOrder(char); s.freq[leaf] > 0 {
+		return leaf
+	}
+	return -1
+}
+
+// less orders the nodes by frequency, ties are broken by their index.
+func (s *symbols) less(a, b int16) bool {
+	if s.freq[a] != s.freq[b] {
+		return s.freq[a] < s.freq[b]
+	}
+	return a < b
+}
+
+func (s *symbols) insert(char rune) {
+	leaf := int16(symbolOrder(char))
+	s.freq[leaf] = 1
+	s.total++
+	// move the leaves ordered after the new one up to make room for it
+	i := s.nleaves
+	for ; i > 0 && s.less(leaf, s.leaves[i-1]); i-- {
+		s.leaves[i] = s.leaves[i-1]
+		s.pos[s.leaves[i]] = int16(i)
+	}
+	s.leaves[i], s.pos[leaf] = leaf, int16(i)
+	s.nleaves++
+	s.buildTree()
+}
+
+func (s *symbols) update(leaf int) {
+	s.freq[leaf]++
+	s.total++
+	// move the leaf past the ones ordered before it now
+	i := int(s.pos[leaf])
+	for ; i+1 < s.nleaves && s.less(s.leaves[i+1], int16(leaf)); i++ {
+		s.leaves[i] = s.leaves[i+1]
+		s.pos[s.leaves[i]] = int16(i)
+	}
+	s.leaves[i], s.pos[leaf] = int16(leaf), int16(i)
+	s.buildTree()
+}
+
+// buildTree builds the Huffman tree of the leaves.
+// Nodes are merged smallest first in the order given by less, which is total,
+// so the shape of the tree (and therefore the bitstream) depends only on the frequencies.
+// Internal nodes are created in that order as well, so the next smallest node
+// is either the next leaf or the next internal node not merged yet.
+func (s *symbols) buildTree() {
+	next, merged := 0, 0
+	for created := range s.nleaves - 1 {
+		var children [2]int16
+		for i := range children {
+			if next < s.nleaves && (merged == created || s.less(s.leaves[next], int16(maxChars+merged))) {
+				children[i] = s.leaves[next]
+				next++
+			} else {
+				children[i] = int16(maxChars + merged)
+				merged++
+			}
+		}
+		s.left[created], s.right[created] = children[0], children[1]
+		s.freq[maxChars+created] = s.freq[children[0]] + s.freq[children[1]]
+	}
+	s.root = int16(maxChars + s.nleaves - 2)
+	s.codesValid = false
+}
+
+// computeCodes fills the code table from the tree.
+// Left children get bit 0, Right children get bit 1.
+func (s *symbols) computeCodes() {
+	// codes of the internal nodes, parents come after their children
+	var internal [maxChars - 1]leafCode
+	for i := int(s.root) - maxChars; i >= 0; i-- {
+		parent := internal[i]
+		for bit, child := range [2]int16{s.left[i], s.right[i]} {
+			c := leafCode{code: parent.code<<1 | uint64(bit), length: parent.length + 1}
+			if child >= maxChars {
+				internal[child-maxChars] = c
+			} else {
+				s.codes[child] = c
+			}
+		}
+	}
+	s.codesValid = true
+}
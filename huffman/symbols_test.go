@@ -0,0 +1,117 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// allocRuns is the number of chunks AllocsPerRun averages over.
+const allocRuns = 100
+
+func TestWriteAllocs(t *testing.T) {
+	data := testData(64 << 10)
+	chunk := data[:4<<10]
+	for _, method := range methods {
+		w := NewWriterOptions(io.Discard, Options{Method: method})
+		// the model has seen every byte and the buffers have grown
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		allocs := testing.AllocsPerRun(allocRuns, func() {
+			if _, err := w.Write(chunk); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("%s: %g allocations per Write of %d bytes", method, allocs, len(chunk))
+		}
+		allocs = testing.AllocsPerRun(allocRuns, func() {
+			if err := w.WriteByte(chunk[0]); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("%s: %g allocations per WriteByte", method, allocs)
+		}
+	}
+}
+
+func TestReadAllocs(t *testing.T) {
+	data := testData((allocRuns + 20) * 4 << 10)
+	for _, method := range methods {
+		r := NewReader(bytes.NewReader(compressed(t, Options{Method: method}, data)))
+		buf := make([]byte, 4<<10)
+		for range 10 {
+			if _, err := io.ReadFull(r, buf); err != nil {
+				t.Fatal(err)
+			}
+		}
+		allocs := testing.AllocsPerRun(allocRuns, func() {
+			if _, err := io.ReadFull(r, buf); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("%s: %g allocations per Read of %d bytes", method, allocs, len(buf))
+		}
+		allocs = testing.AllocsPerRun(allocRuns, func() {
+			if _, err := r.ReadByte(); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("%s: %g allocations per ReadByte", method, allocs)
+		}
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, io.ErrShortWrite
+}
+
+func TestCopyAllocs(t *testing.T) {
+	data := testData(64 << 10)
+	chunk := bytes.NewReader(data[:4<<10])
+	for _, method := range methods {
+		w := NewWriterOptions(io.Discard, Options{Method: method})
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		// the buffer of the first call is reused
+		allocs := testing.AllocsPerRun(allocRuns, func() {
+			chunk.Seek(0, io.SeekStart)
+			if _, err := w.ReadFrom(chunk); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("%s: %g allocations per ReadFrom of %d bytes", method, allocs, chunk.Size())
+		}
+	}
+
+	// every WriteTo fails with the first chunk, flushed every 100 bytes.
+	// Only the Huffman method, as the range coder starts over at every flush point,
+	// and RANS writes its blocks.
+	var chunks [][]byte
+	for i := range allocRuns + 20 {
+		chunks = append(chunks, data[i*100:(i+1)*100])
+	}
+	r := NewReader(bytes.NewReader(compressed(t, Options{}, chunks...)))
+	for range 10 {
+		if _, err := r.WriteTo(failingWriter{}); err != io.ErrShortWrite {
+			t.Fatal(err)
+		}
+	}
+	allocs := testing.AllocsPerRun(allocRuns, func() {
+		if _, err := r.WriteTo(failingWriter{}); err != io.ErrShortWrite {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("%g allocations per WriteTo", allocs)
+	}
+}
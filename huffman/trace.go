@@ -0,0 +1,152 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// TraceEvent describes a single symbol coded by a Writer or decoded by a Reader.
+// Traces of an encoder and a decoder of the same stream must be identical,
+// so the first event where they differ is where the two went out of sync.
+type TraceEvent struct {
+	// Index is the position of the symbol in the stream.
+	Index int64
+	// Offset is the bit offset of the symbol's code in the compressed stream.
+	// The range coder codes symbols in fractions of bits, so with the Range method
+	// it's the offset of the byte the coder is at, counted in bits.
+	Offset int64
+	Char   rune
+	// New tells if the symbol was coded as newChar followed by a literal.
+	// Code is the code of newChar then.
+	New bool
+	// Code is the code of the symbol, Length bits long.
+	// With the Range method it's the start of the symbol's range, in 16 bits.
+	Code   uint64
+	Length uint8
+	// Hash is the hash of the tree after the symbol has been coded and the tree updated.
+	Hash uint64
+}
+
+// TraceHeader is the comment line describing the fields of TraceEvent.String.
+const TraceHeader = "# index\toffset\tchar\tnew\tlength\tcode\thash\tsymbol"
+
+// String returns the event as a single line of tab separated fields.
+// The line can be parsed back with ParseTraceEvent.
+func (e TraceEvent) String() string {
+	return fmt.Sprintf("%d\t%d\t%d\t%t\t%d\t%s\t%016x\t%s",
+		e.Index, e.Offset, e.Char, e.New, e.Length, formatCode(e.Code, e.Length), e.Hash, symbolName(e.Char))
+}
+
+// ParseTraceEvent parses a line produced by TraceEvent.String.
+func ParseTraceEvent(line string) (e TraceEvent, err error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) < 7 {
+		return e, fmt.Errorf("trace: expected at least 7 fields, got %d", len(fields))
+	}
+	if e.Index, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+		return e, fmt.Errorf("trace: index: %w", err)
+	}
+	if e.Offset, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+		return e, fmt.Errorf("trace: offset: %w", err)
+	}
+	char, err := strconv.ParseInt(fields[2], 10, 32)
+	if err != nil {
+		return e, fmt.Errorf("trace: char: %w", err)
+	}
+	e.Char = rune(char)
+	if e.New, err = strconv.ParseBool(fields[3]); err != nil {
+		return e, fmt.Errorf("trace: new: %w", err)
+	}
+	length, err := strconv.ParseUint(fields[4], 10, 8)
+	if err != nil {
+		return e, fmt.Errorf("trace: length: %w", err)
+	}
+	e.Length = uint8(length)
+	if len(fields[5]) != int(e.Length) {
+		return e, fmt.Errorf("trace: code %q doesn't have length %d", fields[5], e.Length)
+	}
+	if e.Length > 0 {
+		if e.Code, err = strconv.ParseUint(fields[5], 2, 64); err != nil {
+			return e, fmt.Errorf("trace: code: %w", err)
+		}
+	}
+	if e.Hash, err = strconv.ParseUint(fields[6], 16, 64); err != nil {
+		return e, fmt.Errorf("trace: hash: %w", err)
+	}
+	return e, nil
+}
+
+// tracer reports coded symbols to a trace function.
+// It's shared by Writer and Reader.
+type tracer struct {
+	// fn is called for every coded symbol if set, see SetTrace
+	fn func(TraceEvent)
+	// number of symbols coded so far
+	coded int64
+}
+
+// SetTrace makes fn get called for every symbol coded from now on.
+// A nil fn turns tracing off.
+// Tracing must be turned on before the first symbol for the offsets to be right.
+// Tracing is slow, since the whole tree is hashed after every symbol.
+// Models without a tree get a zero hash.
+func (t *tracer) SetTrace(fn func(TraceEvent)) {
+	t.fn = fn
+}
+
+// tracing tells if a trace function is set.
+func (t *tracer) tracing() bool {
+	return t.fn != nil
+}
+
+// traceSymbol reports the coded char to the trace function, if there's one.
+// It must be called after the model m has been updated.
+func (t *tracer) traceSymbol(m Model, offset int64, char rune, isNew bool, code uint64, length uint8) {
+	index := t.coded
+	t.coded++
+	if t.fn == nil {
+		return
+	}
+	var hash uint64
+	if h, ok := m.(interface{ hash() uint64 }); ok {
+		hash = h.hash()
+	}
+	t.fn(TraceEvent{
+		Index:  index,
+		Offset: offset,
+		Char:   char,
+		New:    isNew,
+		Code:   code,
+		Length: length,
+		Hash:   hash,
+	})
+}
+
+// hash returns the FNV-1a hash of the tree shape together with the characters and frequencies of the leaves.
+func (s *symbols) hash() uint64 {
+	h := fnv.New64a()
+	var buf [13]byte
+
+	var traverse func(n int16)
+
+	traverse = func(n int16) {
+		if n < maxChars {
+			// it's a leaf
+			buf[0] = 1
+			binary.BigEndian.PutUint32(buf[1:], uint32(orderChar(int(n))))
+			binary.BigEndian.PutUint64(buf[5:], uint64(s.freq[n]))
+			h.Write(buf[:])
+			return
+		}
+		buf[0] = 0
+		h.Write(buf[:1])
+		traverse(s.left[n-maxChars])
+		traverse(s.right[n-maxChars])
+	}
+
+	traverse(s.root)
+	return h.Sum64()
+}
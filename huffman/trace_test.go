@@ -0,0 +1,129 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// traces returns the events of the Writer compressing the chunks with opts,
+// flushing after each but the last, and those of the Reader decompressing them.
+func traces(t *testing.T, opts Options, chunks ...[]byte) (written, read []TraceEvent) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriterOptions(&buf, opts)
+	w.SetTrace(func(e TraceEvent) { written = append(written, e) })
+	for i, chunk := range chunks {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+		if i < len(chunks)-1 {
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := NewReaderOptions(&buf, opts)
+	r.SetTrace(func(e TraceEvent) { read = append(read, e) })
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	return written, read
+}
+
+func TestTraceEqual(t *testing.T) {
+	text := []byte("abracadabra, abracadabra! the quick brown fox jumps over the lazy dog")
+	for _, opts := range []Options{
+		{},
+		{Preseed: true},
+		{Method: Range},
+		{Method: Range, Preseed: true},
+		{Model: textCodebook(t, text[:20])},
+	} {
+		written, read := traces(t, opts, text[:20], text[20:], testData(5000))
+		if len(written) == 0 || len(written) != len(read) {
+			t.Errorf("%+v: %d events written, %d read", opts, len(written), len(read))
+			continue
+		}
+		for i := range written {
+			if written[i] != read[i] {
+				t.Errorf("%+v: event %d written as %v, read as %v", opts, i, written[i], read[i])
+				break
+			}
+		}
+
+		// every symbol is at its own place in the stream, with a code
+		var offset int64
+		var codes int
+		for i, e := range written {
+			if e.Index != int64(i) || e.Offset < offset {
+				t.Errorf("%+v: event %d has index %d and offset %d, after offset %d", opts, i, e.Index, e.Offset, offset)
+				break
+			}
+			offset = e.Offset
+			if e.Length == 0 {
+				t.Errorf("%+v: event %d without a code", opts, i)
+				break
+			}
+			if e.Code != 0 {
+				codes++
+			}
+		}
+		if offset == 0 || codes == 0 {
+			t.Errorf("%+v: every event at offset 0 or with code 0", opts)
+		}
+	}
+}
+
+func TestTraceRangeOffsets(t *testing.T) {
+	// a flush point ends a range coder, the next symbol is past its final bytes
+	written, _ := traces(t, Options{Method: Range}, []byte("ab"), []byte("c"))
+	var chars []rune
+	for _, e := range written {
+		chars = append(chars, e.Char)
+	}
+	if want := []rune{'a', 'b', End, 'c', End}; string(chars) != string(want) {
+		t.Fatalf("traced %q, want %q", chars, want)
+	}
+	if first, next := written[2].Offset, written[3].Offset; next < first+5*8 {
+		t.Errorf("symbol after the flush at offset %d, the flushed End at %d", next, first)
+	}
+}
+
+func TestParseTraceEvent(t *testing.T) {
+	for _, e := range []TraceEvent{
+		{Index: 0, Offset: 0, Char: 'a', New: true, Code: 0, Length: 1, Hash: 0x0123456789abcdef},
+		{Index: 123456, Offset: 987654321, Char: 0xff, Code: 0b10110, Length: 5, Hash: 1<<64 - 1},
+		{Index: 3, Offset: 40, Char: End, Code: 0xbeef, Length: rangeCodeLength},
+		{Index: 4, Offset: 48, Char: Escape},
+	} {
+		line := e.String()
+		got, err := ParseTraceEvent(line)
+		if err != nil || got != e {
+			t.Errorf("ParseTraceEvent(%q) = %v, %v, want %v", line, got, err, e)
+		}
+	}
+
+	valid := strings.Split(TraceEvent{Index: 1, Offset: 2, Char: 'a', Code: 0b101, Length: 3, Hash: 4}.String(), "\t")
+	for i, field := range []string{"x", "-", "a", "maybe", "300", "10x", "xyz"} {
+		fields := append([]string(nil), valid...)
+		fields[i] = field
+		if e, err := ParseTraceEvent(strings.Join(fields, "\t")); err == nil {
+			t.Errorf("field %d set to %q parsed as %v", i, field, e)
+		}
+	}
+	for _, line := range []string{
+		"",
+		"1\t2\t97\tfalse\t3\t101",
+		// the code doesn't have the length given
+		"1\t2\t97\tfalse\t3\t10\t4",
+	} {
+		if e, err := ParseTraceEvent(line); err == nil {
+			t.Errorf("%q parsed as %v", line, e)
+		}
+	}
+}
@@ -0,0 +1,465 @@
+package huffman
+
+import (
+	"errors"
+	"fmt"
+	"huffman_coding/bits"
+	"io"
+)
+
+// Writer is the Huffman writer implementation.
+// Must be closed in order to properly send EOF.
+type Writer struct {
+	tracer
+	// model codes the symbols of the Huffman method
+	model Model
+	// adaptive model of the Range method and the default model of the Huffman method
+	symbols *symbols
+	bw      *bits.Writer
+	header  header
+	// set once the header has been written
+	started bool
+	// range coder, only used by the Range method
+	rc *rangeEncoder
+	// data of the current block, only used by the RANS method
+	block []byte
+	// bytes not written as literals yet, nil unless flagUnseenLiterals is set
+	unseen *unseenBytes
+	// number of bits written so far
+	offset int64
+	// set by Flush until the next symbol, so that flushing twice writes nothing
+	flushed bool
+	// number of bytes written so far
+	written int64
+	// error found by the constructor, reported by the first write
+	err error
+	// chunks copied by ReadFrom and CompressContext, allocated on first use
+	buf []byte
+}
+
+// Options configures a Writer or a Reader.
+// The zero value gives the defaults.
+type Options struct {
+	// Method is the entropy coder to use, Huffman by default.
+	// Readers take the method from the header and ignore this.
+	Method Method
+	// Model is the model of the Huffman method, NewAdaptiveModel() by default.
+	// A Reader must be given a model equivalent to the one of the Writer.
+	// Other methods don't support custom models.
+	// Bytes escaped by custom models are written as plain 8 bit literals,
+	// the default model codes them relative to the bytes it hasn't seen yet.
+	Model Model
+	// Preseed starts the default model with every byte at frequency 1 instead of empty,
+	// so no byte is ever escaped. It pays off for short inputs using many distinct bytes.
+	// It's ignored by the RANS method and Readers, which take it from the header.
+	Preseed bool
+	// Size is the number of bytes that will be written, recorded in the header if positive,
+	// so that Reader.Size can tell the uncompressed size without decoding anything.
+	// Close fails if a different number of bytes has been written.
+	// Readers take it from the header and ignore this.
+	Size int64
+	// MaxSize makes a Reader fail with ErrLimitExceeded instead of decompressing more than MaxSize bytes,
+	// if positive. Writers ignore it.
+	MaxSize int64
+	// MaxRatio makes a Reader fail with ErrLimitExceeded instead of decompressing more than
+	// MaxRatio times the compressed bytes read so far, if positive.
+	// The first MiB is always allowed, so that short inputs aren't refused
+	// for their header dominating their size. Writers ignore it.
+	MaxRatio float64
+	// Dictionary primes the default model with the frequencies of training data, see Train.
+	// With order-1 tables the Huffman method codes every byte with the model of the preceding byte.
+	// A Reader must be given the same dictionary, identified by the ID recorded in the header.
+	// It's ignored by the RANS method, and by Readers of streams coded without a dictionary.
+	Dictionary *Dictionary
+}
+
+// newModel returns the model for the stream described by h.
+// The adaptive model is returned both as *symbols and Model,
+// custom models and models with contexts only as Model.
+func newModel(h header, custom Model, dict *Dictionary) (*symbols, Model, error) {
+	preseed := h.flags&flagPreseeded != 0
+	if h.flags&flagDictionary != 0 {
+		switch {
+		case custom != nil:
+			return nil, nil, errors.New("huffman: dictionaries need the default model")
+		case dict == nil:
+			return nil, nil, fmt.Errorf("%w: stream needs dictionary %08x", ErrDictionary, h.dict)
+		case dict.id != h.dict:
+			return nil, nil, fmt.Errorf("%w: stream needs dictionary %08x, got %08x", ErrDictionary, h.dict, dict.id)
+		}
+		if usesContexts(h.method, dict) {
+			return nil, newContextModel(dict, preseed), nil
+		}
+		freqs := primeFreqs(&dict.freqs, dictWeight)
+		s := newSymbolsFreqs(&freqs, preseed)
+		return s, s, nil
+	}
+	if custom == nil {
+		s := newSymbols(preseed)
+		return s, s, nil
+	}
+	if h.method != Huffman {
+		return nil, nil, fmt.Errorf("huffman: method %s doesn't support custom models", h.method)
+	}
+	if h.flags&flagPreseeded != 0 {
+		return nil, nil, errors.New("huffman: preseeding needs the default model")
+	}
+	return nil, custom, nil
+}
+
+// NewWriter returns a Writer coding with the default options.
+func NewWriter(out io.Writer) *Writer {
+	return NewWriterOptions(out, Options{})
+}
+
+// NewWriterOptions returns a Writer configured by opts.
+func NewWriterOptions(out io.Writer, opts Options) *Writer {
+	w := &Writer{
+		bw:     bits.NewWriter(out),
+		header: header{method: opts.Method},
+	}
+	if opts.Method != RANS {
+		// literals escaped by the context models can be bytes seen in other contexts,
+		// so they can't be coded relative to the unseen bytes
+		if opts.Model == nil && !usesContexts(opts.Method, opts.Dictionary) {
+			w.header.flags |= flagUnseenLiterals
+		}
+		if opts.Preseed {
+			w.header.flags |= flagPreseeded
+		}
+		if opts.Dictionary != nil {
+			w.header.flags |= flagDictionary
+			w.header.dict = opts.Dictionary.id
+		}
+	}
+	if opts.Size > 0 {
+		w.header.flags |= flagSize
+		w.header.size = uint64(opts.Size)
+	}
+	w.symbols, w.model, w.err = newModel(w.header, opts.Model, opts.Dictionary)
+	if w.header.flags&flagUnseenLiterals != 0 {
+		w.unseen = newUnseenBytes()
+		w.unseen.removeKnown(w.symbols)
+	}
+	switch opts.Method {
+	case Range:
+		w.rc = newRangeEncoder(w.bw)
+	case RANS:
+		w.block = make([]byte, 0, ransBlockSize)
+	}
+	return w
+}
+
+// start writes the header before the first symbol.
+func (w *Writer) start() error {
+	if w.started {
+		return nil
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if w.header.method >= numMethods {
+		return fmt.Errorf("huffman: unknown method %d", w.header.method)
+	}
+	w.started = true
+	return w.header.write(w.bw)
+}
+
+// Write writes the compressed form of p to the underlying io.Writer.
+// The compressed byte(s) are not necessarily flushed until the Writer is closed.
+func (w *Writer) Write(p []byte) (n int, err error) {
+	if err := w.start(); err != nil {
+		return 0, err
+	}
+	return w.writeBytes(p)
+}
+
+// ReadFrom implements io.ReaderFrom, compressing everything read from src until io.EOF.
+// The RANS method reads src straight into its blocks.
+func (w *Writer) ReadFrom(src io.Reader) (n int64, err error) {
+	if err := w.start(); err != nil {
+		return 0, err
+	}
+	if w.header.method == RANS {
+		return w.readBlocks(src)
+	}
+	buf := w.chunk()
+	for {
+		k, err := src.Read(buf)
+		if k > 0 {
+			k, err := w.writeBytes(buf[:k])
+			n += int64(k)
+			if err != nil {
+				return n, err
+			}
+		}
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// chunk returns the buffer of chunkSize bytes ReadFrom and CompressContext copy through.
+func (w *Writer) chunk() []byte {
+	if w.buf == nil {
+		w.buf = make([]byte, chunkSize)
+	}
+	return w.buf
+}
+
+// writeBytes is Write after the header has been written.
+// The method and tracing are checked once for all of p, instead of for every byte as by writeByte.
+func (w *Writer) writeBytes(p []byte) (n int, err error) {
+	switch {
+	case len(p) == 0:
+		return 0, nil
+	case w.header.method == RANS:
+		return w.writeBlock(p)
+	case w.tracing():
+		for n < len(p) {
+			if err = w.writeByte(p[n]); err != nil {
+				return n, err
+			}
+			n++
+		}
+		return n, nil
+	}
+	w.flushed = false
+	if w.header.method == Range {
+		for ; n < len(p); n++ {
+			if err = w.encodeRange(rune(p[n])); err != nil {
+				break
+			}
+		}
+	} else {
+		for ; n < len(p); n++ {
+			if _, _, _, err = w.writeCode(p[n]); err != nil {
+				break
+			}
+		}
+		// keep the index of the following symbols right, should tracing be turned on
+		w.coded += int64(n)
+	}
+	w.written += int64(n)
+	return n, err
+}
+
+// WriteByte writes the compressed form of b to the underlying io.Writer.
+// The compressed byte(s) are not necessarily flushed until the Writer is closed.
+func (w *Writer) WriteByte(b byte) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	return w.writeByte(b)
+}
+
+// writeByte is WriteByte after the header has been written.
+func (w *Writer) writeByte(b byte) error {
+	w.flushed = false
+	w.written++
+	switch w.header.method {
+	case Range:
+		return w.encodeRange(rune(b))
+	case RANS:
+		w.block = append(w.block, b)
+		if len(w.block) == ransBlockSize {
+			return w.flushBlock()
+		}
+		return nil
+	}
+
+	offset := w.offset
+	code, count, known, err := w.writeCode(b)
+	if err != nil {
+		return err
+	}
+	w.traceSymbol(w.model, offset, rune(b), !known, code, count)
+	return nil
+}
+
+// writeCode writes b with the Huffman method and updates the model.
+// It returns the code written first, the one of b if it's known, or else of Escape.
+func (w *Writer) writeCode(b byte) (code uint64, count uint8, known bool, err error) {
+	char := rune(b)
+	code, count, known = w.model.Code(char)
+	if known {
+		// Character has a code (in the adaptive model: it has been encountered already).
+		// So we write its code and update the model.
+		if err := w.bw.WriteBits(code, count); err != nil {
+			return 0, 0, false, err
+		}
+		w.offset += int64(count)
+	} else {
+		// Character has no code (in the adaptive model: it's encountered the first time).
+		// So we write the escape character and then the character itself.
+		var ok bool
+		if code, count, ok = w.model.Code(Escape); !ok {
+			return 0, 0, false, errNoCode
+		}
+		if err := w.bw.WriteBits(code, count); err != nil {
+			return 0, 0, false, err
+		}
+		w.offset += int64(count)
+		if err := w.writeLiteral(b); err != nil {
+			return 0, 0, false, err
+		}
+	}
+	w.model.Update(char)
+	return code, count, known, nil
+}
+
+// Flush writes everything written so far to the underlying io.Writer,
+// so that a Reader can decode all of it without waiting for more data.
+// The model is kept, so the following data is coded just as well as without the flush.
+//
+// The Huffman and Range methods mark the flush with End followed by a bit telling that more follows,
+// padded to a byte or followed by the final bytes of the range coder, which costs up to a few bytes every time.
+// Only the End written by Close has that bit cleared, so a stream cut off at a flush point is noticed.
+// The RANS method ends the current block early.
+func (w *Writer) Flush() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	if !w.flushed {
+		switch w.header.method {
+		case Range:
+			if err := w.endRange(true); err != nil {
+				return err
+			}
+			w.rc = newRangeEncoder(w.bw)
+		case RANS:
+			if err := w.flushBlock(); err != nil {
+				return err
+			}
+		default:
+			if err := w.writeEnd(true); err != nil {
+				return err
+			}
+			unset, err := w.bw.Align()
+			if err != nil {
+				return err
+			}
+			w.offset += int64(unset)
+		}
+		w.flushed = true
+	}
+	return w.bw.Flush()
+}
+
+// Close closes the Huffman writer properly, sending EOF.
+// If the underlying io.Writer implements io.Closer
+// it will be closed after sending EOF.
+func (w *Writer) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	if w.header.flags&flagSize != 0 && uint64(w.written) != w.header.size {
+		return fmt.Errorf("huffman: %d bytes written, but the header promises %d", w.written, w.header.size)
+	}
+	switch w.header.method {
+	case Range:
+		if err := w.endRange(false); err != nil {
+			return err
+		}
+	case RANS:
+		if err := w.flushBlock(); err != nil {
+			return err
+		}
+		if err := writeRANSEnd(w.bw); err != nil {
+			return err
+		}
+	default:
+		if err := w.writeEnd(false); err != nil {
+			return err
+		}
+	}
+	return w.bw.Close()
+}
+
+// writeEnd writes the code of End with the Huffman method,
+// followed by a bit set if more follows the End of a flush.
+func (w *Writer) writeEnd(more bool) error {
+	code, count, ok := w.model.Code(End)
+	if !ok {
+		return errNoCode
+	}
+	if err := w.bw.WriteBits(code, count); err != nil {
+		return err
+	}
+	w.traceSymbol(w.model, w.offset, End, false, code, count)
+	w.offset += int64(count) + 1
+	return w.bw.WriteOneBit(more)
+}
+
+// writeLiteral writes the escaped byte b.
+func (w *Writer) writeLiteral(b byte) error {
+	if w.unseen == nil {
+		w.offset += 8
+		return w.bw.WriteByte(b)
+	}
+	code, count := truncatedBinary(w.unseen.index(b), w.unseen.count)
+	w.unseen.remove(b)
+	w.offset += int64(count)
+	return w.bw.WriteBits(code, count)
+}
+
+// Root returns the root of the current Huffman tree of the model,
+// or nil if the model isn't backed by a tree.
+// The adaptive model returns a copy of its tree, which isn't updated by the following writes.
+func (w *Writer) Root() *Node {
+	return modelRoot(w.model)
+}
+
+// writeBlock adds p to the RANS blocks, which are coded as a whole once full.
+func (w *Writer) writeBlock(p []byte) (n int, err error) {
+	for n < len(p) {
+		k := min(len(p)-n, ransBlockSize-len(w.block))
+		w.block = append(w.block, p[n:n+k]...)
+		w.flushed = false
+		w.written += int64(k)
+		n += k
+		if len(w.block) == ransBlockSize {
+			if err = w.flushBlock(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// readBlocks is ReadFrom with the RANS method, reading src straight into the block.
+func (w *Writer) readBlocks(src io.Reader) (n int64, err error) {
+	for {
+		k, err := src.Read(w.block[len(w.block):ransBlockSize])
+		if k > 0 {
+			w.block = w.block[:len(w.block)+k]
+			w.flushed = false
+			w.written += int64(k)
+			n += int64(k)
+		}
+		if len(w.block) == ransBlockSize {
+			if err := w.flushBlock(); err != nil {
+				return n, err
+			}
+		}
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// flushBlock codes the buffered block of the RANS method.
+func (w *Writer) flushBlock() error {
+	if len(w.block) == 0 {
+		return nil
+	}
+	err := writeRANSBlock(w.bw, w.block)
+	w.block = w.block[:0]
+	return err
+}
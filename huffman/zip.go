@@ -0,0 +1,40 @@
+package huffman
+
+import (
+	"archive/zip"
+	"io"
+	"sync"
+)
+
+// ZipMethod is the private compression method ID of zip entries holding a Huffman stream.
+// Other zip tools don't know it and can't extract such entries.
+const ZipMethod uint16 = 0x4855
+
+// ZipCompressor returns a zip.Compressor coding entries with Writers configured by opts,
+// for zip.Writer.RegisterCompressor with ZipMethod.
+func ZipCompressor(opts Options) zip.Compressor {
+	return func(w io.Writer) (io.WriteCloser, error) {
+		return NewWriterOptions(w, opts), nil
+	}
+}
+
+// ZipDecompressor returns a zip.Decompressor decoding entries with Readers configured by opts,
+// for zip.Reader.RegisterDecompressor with ZipMethod.
+func ZipDecompressor(opts Options) zip.Decompressor {
+	return func(r io.Reader) io.ReadCloser {
+		return io.NopCloser(NewReaderOptions(r, opts))
+	}
+}
+
+var registerZip sync.Once
+
+// RegisterZip registers the default options for ZipMethod with zip.RegisterCompressor
+// and zip.RegisterDecompressor, so that all zip readers and writers support it.
+// It may be called any number of times.
+// Archives needing other options, like a Dictionary, register their own per archive.
+func RegisterZip() {
+	registerZip.Do(func() {
+		zip.RegisterCompressor(ZipMethod, ZipCompressor(Options{}))
+		zip.RegisterDecompressor(ZipMethod, ZipDecompressor(Options{}))
+	})
+}
@@ -0,0 +1,95 @@
+package huffman
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func writeZip(t *testing.T, register func(zw *zip.Writer), files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	register(zw)
+	for name, content := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: ZipMethod})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readZip returns the contents of the archive, or the first error reading it.
+func readZip(t *testing.T, data []byte, register func(zr *zip.Reader)) (map[string]string, error) {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	register(zr)
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		if f.Method != ZipMethod {
+			t.Errorf("%s has method %d, want ZipMethod", f.Name, f.Method)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		files[f.Name] = string(content)
+	}
+	return files, nil
+}
+
+func TestZipPerArchive(t *testing.T) {
+	RegisterZip()
+	dict := Train([][]byte{[]byte("the quick brown fox jumps over the lazy dog")})
+	opts := Options{Method: Huffman, Dictionary: dict}
+	files := map[string]string{
+		"a.txt":     "the lazy dog jumps over the quick brown fox",
+		"dir/b.txt": "",
+	}
+	data := writeZip(t, func(zw *zip.Writer) { zw.RegisterCompressor(ZipMethod, ZipCompressor(opts)) }, files)
+
+	got, err := readZip(t, data, func(zr *zip.Reader) { zr.RegisterDecompressor(ZipMethod, ZipDecompressor(opts)) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range files {
+		if got[name] != want {
+			t.Errorf("%s = %q, want %q", name, got[name], want)
+		}
+	}
+
+	// the default options registered by RegisterZip don't know the dictionary
+	if _, err := readZip(t, data, func(*zip.Reader) {}); !errors.Is(err, ErrDictionary) {
+		t.Errorf("reading with the default options: %v, want ErrDictionary", err)
+	}
+}
+
+func TestRegisterZip(t *testing.T) {
+	// registering twice would panic in the zip package
+	RegisterZip()
+	RegisterZip()
+
+	files := map[string]string{"a.txt": "abracadabra"}
+	data := writeZip(t, func(*zip.Writer) {}, files)
+	got, err := readZip(t, data, func(*zip.Reader) {})
+	if err != nil || got["a.txt"] != files["a.txt"] {
+		t.Errorf("round trip with the global registration: %q, %v", got, err)
+	}
+}
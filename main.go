@@ -1,47 +1,92 @@
 package main
 
 import (
-	"flag"
+	"errors"
 	"fmt"
-	"io"
 	"os"
 )
 
+const usage = `usage: huff <command> [flags] [files...]
+
+commands:
+  compress    compress files (default suffix .huff)
+  decompress  decompress files
+  test        check integrity of compressed files
+  info        print code table and compression statistics of files
+  cat         decompress files to standard output
+  tree        export the Huffman tree of files as Graphviz DOT or JSON
+  trace       trace the adaptive model while encoding or decoding files
+  diff        find the first step where two traces disagree
+  compare     compare the compression ratios of all coding methods
+  train       build a dictionary from sample files for compress -dict
+  zip         store files and directories in a zip archive of compressed entries
+  unzip       list or extract the files of a zip archive
+  archive     store files and directories in a compressed tar archive
+  extract     list or extract the members of a compressed tar archive
+
+A file name of "-" or no file names at all means standard input.
+Run "huff <command> -h" for the flags of a command.
+`
+
+// Exit codes. Usage errors follow the flag package convention.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// errSilent is returned by a command when the actual errors have already been reported,
+// so main only needs to set the exit code.
+var errSilent = errors.New("silent")
+
 func main() {
-	decode := flag.Bool("d", false, "specifies that program should decode data")
-	input := flag.String("input", "", "input file")
-	output := flag.String("output", "", "output file")
-	flag.Parse()
-
-	inputFile, err := os.Open(*input)
-	if err != nil {
-		fmt.Println(err)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(exitUsage)
 	}
-	defer inputFile.Close()
 
-	outputFile, err := os.Create(*output)
-	if err != nil {
-		fmt.Println(err)
+	var run func(args []string) error
+	switch cmd := os.Args[1]; cmd {
+	case "compress", "c":
+		run = runCompress
+	case "decompress", "d":
+		run = runDecompress
+	case "test", "t":
+		run = runTest
+	case "info", "i":
+		run = runInfo
+	case "cat":
+		run = runCat
+	case "tree":
+		run = runTree
+	case "trace":
+		run = runTrace
+	case "diff":
+		run = runDiff
+	case "compare":
+		run = runCompare
+	case "train":
+		run = runTrain
+	case "zip":
+		run = runZip
+	case "unzip":
+		run = runUnzip
+	case "archive":
+		run = runArchive
+	case "extract":
+		run = runExtract
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		os.Exit(exitOK)
+	default:
+		fmt.Fprintf(os.Stderr, "huff: unknown command %q\n\n%s", cmd, usage)
+		os.Exit(exitUsage)
 	}
-	defer outputFile.Close()
 
-	if !*decode {
-		w := NewWriter(outputFile)
-		data, err := io.ReadAll(inputFile)
-		if err != nil {
-			fmt.Println(err)
-		}
-		if _, err = w.Write(data); err != nil {
-			fmt.Println(err)
-		}
-		if err = w.Close(); err != nil {
-			fmt.Println(err)
-		}
-	} else {
-		r := NewReader(inputFile)
-		data, err := io.ReadAll(r)
-		if _, err = outputFile.Write(data); err != nil {
-			fmt.Println(err)
+	if err := run(os.Args[2:]); err != nil {
+		if err != errSilent {
+			fmt.Fprintln(os.Stderr, "huff:", err)
 		}
+		os.Exit(exitError)
 	}
 }